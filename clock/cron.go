@@ -0,0 +1,111 @@
+package clock
+
+import (
+	"github.com/robfig/cron"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	Schedule cron.Schedule
+	Job      cron.Job
+	Prev     time.Time
+	Next     time.Time
+}
+
+// Cron runs jobs by schedules with the given clock, like cron.Cron of robfig/cron
+type Cron struct {
+	clock   Clock
+	mutex   sync.Mutex
+	entries []*Entry
+	timer   Timer
+	running bool
+}
+
+func NewCron(clock Clock) *Cron {
+	return &Cron{clock: clock}
+}
+
+func (c *Cron) Schedule(schedule cron.Schedule, job cron.Job) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry := &Entry{Schedule: schedule, Job: job}
+	if c.running {
+		entry.Next = schedule.Next(c.clock.Now())
+	}
+	c.entries = append(c.entries, entry)
+	if c.running {
+		c.arm()
+	}
+}
+
+func (c *Cron) Start() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.running {
+		return
+	}
+	c.running = true
+	now := c.clock.Now()
+	for _, entry := range c.entries {
+		entry.Next = entry.Schedule.Next(now)
+	}
+	c.arm()
+}
+
+func (c *Cron) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.running = false
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
+
+// Entries returns copies of the entries
+func (c *Cron) Entries() []Entry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entries := make([]Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// arm starts the timer to the nearest fire time
+func (c *Cron) arm() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	var next time.Time
+	for _, entry := range c.entries {
+		if !entry.Next.IsZero() && (next.IsZero() || entry.Next.Before(next)) {
+			next = entry.Next
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	c.timer = c.clock.AfterFunc(next.Sub(c.clock.Now()), c.run)
+}
+
+func (c *Cron) run() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.running {
+		return
+	}
+	now := c.clock.Now()
+	for _, entry := range c.entries {
+		if entry.Next.IsZero() || entry.Next.After(now) {
+			continue
+		}
+		go entry.Job.Run()
+		entry.Prev = entry.Next
+		entry.Next = entry.Schedule.Next(now)
+	}
+	c.arm()
+}
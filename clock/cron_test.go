@@ -0,0 +1,100 @@
+package clock
+
+import (
+	"github.com/robfig/cron"
+	"testing"
+	"time"
+)
+
+type testJob struct {
+	name  string
+	fired chan string
+}
+
+func (job testJob) Run() {
+	job.fired <- job.name
+}
+
+func expectFired(t *testing.T, fired chan string, want string) {
+	t.Helper()
+	select {
+	case name := <-fired:
+		if name != want {
+			t.Errorf("fired %v, want %v", name, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%v is not fired", want)
+	}
+}
+
+func expectNothing(t *testing.T, fired chan string) {
+	t.Helper()
+	select {
+	case name := <-fired:
+		t.Errorf("unexpected fire of %v", name)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestCronFiresByFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	fired := make(chan string, 10)
+	c := NewCron(fake)
+	c.Schedule(cron.Every(10*time.Second), testJob{"ten", fired})
+	c.Schedule(cron.Every(15*time.Second), testJob{"fifteen", fired})
+	c.Start()
+
+	fake.Advance(9 * time.Second)
+	expectNothing(t, fired)
+	fake.Advance(time.Second)
+	expectFired(t, fired, "ten")
+	fake.Advance(5 * time.Second)
+	expectFired(t, fired, "fifteen")
+
+	entries := c.Entries()
+	if !entries[0].Prev.Equal(start.Add(10*time.Second)) || !entries[0].Next.Equal(start.Add(20*time.Second)) {
+		t.Errorf("entry %+v, want prev at 10s and next at 20s", entries[0])
+	}
+
+	c.Stop()
+	if fake.Timers() != 0 {
+		t.Errorf("timers %d after stop, want 0", fake.Timers())
+	}
+	fake.Advance(time.Minute)
+	expectNothing(t, fired)
+}
+
+func TestFakeTimersAndTickers(t *testing.T) {
+	fake := NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var order []string
+	fake.AfterFunc(2*time.Second, func() {
+		order = append(order, "second")
+	})
+	fake.AfterFunc(time.Second, func() {
+		order = append(order, "first")
+	})
+	stopped := fake.AfterFunc(time.Second, func() {
+		order = append(order, "stopped")
+	})
+	if !stopped.Stop() {
+		t.Errorf("pending timer is not stopped")
+	}
+	ticker := fake.NewTicker(time.Second)
+
+	fake.Advance(3 * time.Second)
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("fired %v, want first and second", order)
+	}
+	// The ticker drops ticks the receiver missed
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Errorf("missed ticks are not dropped")
+	default:
+	}
+	ticker.Stop()
+	if fake.Timers() != 0 {
+		t.Errorf("timers %d, want 0", fake.Timers())
+	}
+}
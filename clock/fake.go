@@ -0,0 +1,117 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a manual clock, timers fire only on Advance
+type Fake struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	when   time.Time
+	period time.Duration
+	fire   func()
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (clock *Fake) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+func (clock *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	timer := &fakeTimer{clock: clock, when: clock.now.Add(d), fire: f}
+	clock.timers = append(clock.timers, timer)
+	return timer
+}
+
+func (clock *Fake) NewTicker(d time.Duration) Ticker {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	c := make(chan time.Time, 1)
+	timer := &fakeTimer{clock: clock, when: clock.now.Add(d), period: d}
+	timer.fire = func() {
+		// Drop the tick like time.Ticker does for slow receivers
+		select {
+		case c <- clock.Now():
+		default:
+		}
+	}
+	clock.timers = append(clock.timers, timer)
+	return &fakeTicker{timer, c}
+}
+
+// Timers returns the number of pending timers and tickers
+func (clock *Fake) Timers() int {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return len(clock.timers)
+}
+
+// Advance moves the clock, due timers fire in order of their time
+func (clock *Fake) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	until := clock.now.Add(d)
+	clock.mutex.Unlock()
+	for {
+		clock.mutex.Lock()
+		sort.SliceStable(clock.timers, func(i, j int) bool {
+			return clock.timers[i].when.Before(clock.timers[j].when)
+		})
+		if len(clock.timers) == 0 || clock.timers[0].when.After(until) {
+			clock.now = until
+			clock.mutex.Unlock()
+			return
+		}
+		timer := clock.timers[0]
+		if timer.when.After(clock.now) {
+			clock.now = timer.when
+		}
+		if timer.period > 0 {
+			timer.when = timer.when.Add(timer.period)
+		} else {
+			clock.timers = clock.timers[1:]
+		}
+		clock.mutex.Unlock()
+		timer.fire()
+	}
+}
+
+func (timer *fakeTimer) Stop() bool {
+	clock := timer.clock
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	for i, t := range clock.timers {
+		if t == timer {
+			clock.timers = append(clock.timers[:i], clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	timer *fakeTimer
+	c     chan time.Time
+}
+
+func (ticker *fakeTicker) C() <-chan time.Time {
+	return ticker.c
+}
+
+func (ticker *fakeTicker) Stop() {
+	ticker.timer.Stop()
+}
@@ -0,0 +1,92 @@
+package clock
+
+import (
+	"github.com/robfig/cron"
+	"time"
+)
+
+// The longest clock shift (DST or zone change) we expect to see
+const maxClockShift = 3 * time.Hour
+
+// ZonedSchedule evaluates a cron schedule with seconds in the given time zone.
+//
+// DST policy:
+//   - a fire time that falls into a skipped interval (clocks jump forward)
+//     runs once at the moment of the jump;
+//   - a fire time that falls into a repeated interval (clocks jump back)
+//     runs only on the first occurrence.
+type ZonedSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+func NewZonedSchedule(spec string, location *time.Location) (*ZonedSchedule, error) {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &ZonedSchedule{schedule, location}, nil
+}
+
+func (s *ZonedSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.location)
+	for {
+		next := s.schedule.Next(t)
+		if next.IsZero() {
+			return next
+		}
+		if jump, ok := s.skippedFire(t, next); ok {
+			return jump
+		}
+		if s.isRepeated(next) {
+			t = next
+			continue
+		}
+		return next
+	}
+}
+
+// skippedFire checks whether the schedule had a fire time inside a skipped
+// interval between from and to, and returns the moment of the clock jump.
+func (s *ZonedSchedule) skippedFire(from time.Time, to time.Time) (time.Time, bool) {
+	_, offsetFrom := from.Zone()
+	_, offsetTo := to.Zone()
+	if offsetTo <= offsetFrom {
+		return time.Time{}, false
+	}
+
+	// Find the jump moment
+	low, high := from, to
+	for high.Sub(low) > time.Second {
+		middle := low.Add(high.Sub(low) / 2)
+		if _, offset := middle.Zone(); offset == offsetFrom {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	jump := high.Truncate(time.Second)
+	if !jump.After(from) {
+		return time.Time{}, false
+	}
+
+	// Evaluate the schedule by the clock as if it was not moved
+	before := time.FixedZone("", offsetFrom)
+	shift := time.Duration(offsetTo-offsetFrom) * time.Second
+	missed := s.schedule.Next(jump.Add(-time.Second).In(before))
+	if missed.IsZero() || !missed.Before(jump.Add(shift)) {
+		return time.Time{}, false
+	}
+	return jump.In(s.location), true
+}
+
+// isRepeated checks whether the same wall clock time already occurred before t.
+func (s *ZonedSchedule) isRepeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, offsetBefore := t.Add(-maxClockShift).Zone()
+	if offsetBefore <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(offsetBefore-offset) * time.Second)
+	return earlier.Format("2006-01-02 15:04:05") == t.Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZonedScheduleDst(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	utc := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	cases := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		// 2021-03-28 02:00 CET jumps to 03:00 CEST (01:00 UTC)
+		{"skipped fire runs at the jump", "0 30 2 * * *", utc("2021-03-27 23:00"), utc("2021-03-28 01:00")},
+		{"hourly over the jump", "0 0 * * * *", utc("2021-03-28 00:30"), utc("2021-03-28 01:00")},
+		{"after the jump", "0 30 3 * * *", utc("2021-03-27 23:00"), utc("2021-03-28 01:30")},
+		{"next day after the jump", "0 30 2 * * *", utc("2021-03-28 01:00"), utc("2021-03-29 00:30")},
+		// 2021-10-31 03:00 CEST returns to 02:00 CET (01:00 UTC)
+		{"first occurrence of repeated time", "0 30 2 * * *", utc("2021-10-30 22:00"), utc("2021-10-31 00:30")},
+		{"second occurrence is skipped", "0 30 2 * * *", utc("2021-10-31 00:30"), utc("2021-11-01 01:30")},
+		{"hourly over the repeat", "0 30 * * * *", utc("2021-10-31 00:30"), utc("2021-10-31 02:30")},
+		{"winter time", "0 0 12 * * *", utc("2021-12-01 00:00"), utc("2021-12-01 11:00")},
+	}
+	for _, c := range cases {
+		schedule, err := NewZonedSchedule(c.spec, berlin)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+		if next := schedule.Next(c.from); !next.Equal(c.want) {
+			t.Errorf("%v: next after %v is %v, want %v", c.name, c.from, next.UTC(), c.want)
+		}
+	}
+}
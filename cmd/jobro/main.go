@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stepan-s/jobro"
+	"github.com/stepan-s/jobro/config"
+	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/task"
+	"github.com/stepan-s/jobro/shutdown"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit code bits, combined on shutdown
+const exitOk = 0
+const exitServerError = 1
+const exitKilled = 2
+
+func main() {
+	var addr = flag.String("addr", "localhost:80", "http service address")
+	var configCommand = flag.String("config-command", "cat jobro.json", "command that return config")
+	var logLevel = flag.Int64("log-level", log.DEBUG, "log level")
+	var shutdownTimeout = flag.Int64("shutdown-timeout", 60, "shutdown timeout")
+	var timezone = flag.String("timezone", "Local", "default timezone for scheduled tasks")
+	var stateFile = flag.String("state-file", "", "file to keep scheduler state for catch-up")
+	var maxConcurrentTasks = flag.Int("max-concurrent-tasks", 0, "limit of concurrently running scheduled tasks, 0 - unlimited")
+	var maxQueue = flag.Int("max-queue", 0, "default limit of queued runs per group, 0 - unlimited")
+	var maxQueueWait = flag.Int64("max-queue-wait", 0, "default limit of run wait time in queue in seconds, 0 - unlimited")
+	var shutdownDrain = flag.Int64("shutdown-drain-timeout", 0, "time in seconds to wait scheduled tasks before interrupt on shutdown")
+	var shutdownOrder = flag.String("shutdown-order", "", "order of instant pool groups to stop, e.g. consumers,producers")
+	var pid1 = flag.Bool("pid1", os.Getpid() == 1, "run as init: reap zombies of orphaned processes")
+	var forwardSignals = flag.String("forward-signals", "", "signals to forward to tasks, e.g. HUP,USR2:groupA|groupB,WINCH")
+	flag.Parse()
+
+	var logLevelValue = uint8(*logLevel)
+	log.Init(os.Stdout, logLevelValue)
+	log.Info("Starting")
+
+	log.Info("Options:")
+	log.Info("  addr: %v", *addr)
+	log.Info("  config-command: %v", *configCommand)
+	log.Info("  shutdown-timeout: %v", *shutdownTimeout)
+	log.Info("  log-level: %v", *logLevel)
+	log.Info("  timezone: %v", *timezone)
+	log.Info("  state-file: %v", *stateFile)
+	log.Info("  max-concurrent-tasks: %v", *maxConcurrentTasks)
+	log.Info("  max-queue: %v", *maxQueue)
+	log.Info("  max-queue-wait: %v", *maxQueueWait)
+	log.Info("  shutdown-drain-timeout: %v", *shutdownDrain)
+	log.Info("  shutdown-order: %v", *shutdownOrder)
+	log.Info("  pid1: %v", *pid1)
+	log.Info("  forward-signals: %v", *forwardSignals)
+
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		log.Emergency("Fail load timezone: %v", err)
+		os.Exit(1)
+	}
+
+	forwardRules, err := task.ParseForwardSignals(*forwardSignals)
+	if err != nil {
+		log.Emergency("Fail parse forward signals: %v", err)
+		os.Exit(1)
+	}
+
+	if *pid1 {
+		err = task.StartReaper()
+		if err != nil {
+			log.Emergency("Fail start zombie reaper: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	var poolGroups []string
+	for _, name := range strings.Split(*shutdownOrder, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			poolGroups = append(poolGroups, name)
+		}
+	}
+
+	// Create and run services, the default registry keeps go and process metrics
+	mux := http.NewServeMux()
+	manager, err := jobro.New(jobro.Options{
+		Config:        config.Command(*configCommand),
+		Registry:      prometheus.DefaultRegisterer,
+		Mux:           mux,
+		Location:      location,
+		StateFile:     *stateFile,
+		MaxConcurrent: *maxConcurrentTasks,
+		MaxQueue:      *maxQueue,
+		MaxQueueWait:  time.Duration(*maxQueueWait) * time.Second,
+		ShutdownDrain: time.Duration(*shutdownDrain) * time.Second,
+		ShutdownOrder: poolGroups,
+	})
+	if err != nil {
+		log.Emergency("Fail create manager: %v", err)
+		os.Exit(1)
+	}
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- srv.ListenAndServe()
+	}()
+
+	_ = manager.Start()
+
+	go func() {
+		sigusr1 := make(chan os.Signal, 1)
+		signal.Notify(sigusr1, syscall.SIGUSR1)
+
+		for {
+			select {
+			case <-sigusr1:
+				log.Info("Reload signal received")
+				_ = manager.Reload()
+			}
+		}
+	}()
+
+	if len(forwardRules) > 0 {
+		go func() {
+			sigforward := make(chan os.Signal, 1)
+			for _, rule := range forwardRules {
+				signal.Notify(sigforward, rule.Signal)
+			}
+
+			for sig := range sigforward {
+				for _, rule := range forwardRules {
+					if rule.Signal == sig {
+						count := manager.Signal(rule.Signal, rule.Groups)
+						log.Info("Signal %v forwarded to %d processes", sig, count)
+					}
+				}
+			}
+		}()
+	}
+
+	// Wait for a stop signal or a failure of the http server
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM)
+
+	exitCode := exitOk
+	select {
+	case sig := <-stop:
+		switch sig {
+		case os.Interrupt:
+			log.Info("Interrupt signal received, shutdown begin")
+		case syscall.SIGQUIT:
+			log.Info("Quit signal received, shutdown begin")
+		default:
+			log.Info("Terminate signal received, shutdown begin")
+		}
+	case err := <-serverErrors:
+		log.Emergency("Http server error: %v, shutdown begin", err)
+		exitCode |= exitServerError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*shutdownTimeout)*time.Second)
+	report, err := manager.Stop(ctx)
+	cancel()
+	logReport(report)
+	if err != nil {
+		exitCode |= exitKilled
+	}
+
+	err = srv.Shutdown(context.Background())
+	if err != nil {
+		// Error from closing listeners, or context timeout:
+		log.Error("Http server shutdown: %v", err)
+	}
+	log.Info("Http server stopped")
+	log.Info("Shutdown completed, exit code: %d", exitCode)
+	os.Exit(exitCode)
+}
+
+func logReport(report shutdown.Report) {
+	res, err := json.Marshal(report)
+	if err != nil {
+		log.Error("Fail prepare shutdown report: %v", err)
+		return
+	}
+	if report.Clean {
+		log.Info("Shutdown report: %s", res)
+	} else {
+		log.Error("Shutdown report: %s", res)
+	}
+}
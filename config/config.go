@@ -4,67 +4,116 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"github.com/mattn/go-shellwords"
 	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/group"
 	"github.com/stepan-s/jobro/pool/instant"
 	"github.com/stepan-s/jobro/pool/scheduler"
-	"os/exec"
+	"sync"
+	"sync/atomic"
 )
 
 type Config struct {
-	command     string
+	source Source
+	logger *log.Logger
+	// Guards the fingerprint, updates are applied one by one
+	mutex       sync.Mutex
 	fingerprint string
 	onUpdate    func(*TasksConfig)
+	applied     int32
 }
 
 type TasksConfig struct {
 	Schedule []scheduler.TaskSettings
 	Instant  []instant.PoolSettings
+	Groups   map[string]group.Settings
 }
 
-func New(command string) Config {
-	return Config{
-		command: command,
+// New creates a config of the source, the global log is used if the logger is nil
+func New(source Source, logger *log.Logger) *Config {
+	return &Config{
+		source: source,
+		logger: logger,
 	}
 }
 
-func (config *Config) SetOnUpdate(onUpdate func(*TasksConfig))  {
+func (config *Config) SetOnUpdate(onUpdate func(*TasksConfig)) {
 	config.onUpdate = onUpdate
 }
 
-func (config *Config) Update() bool {
-	var err error
-	var args []string
-	args, err = shellwords.Parse(config.command)
-	if err != nil {
-		log.Error("Fail parse args: %v, error: %v", config.command, err)
-		return false
-	}
+// Update reads the config from the source and applies it if changed
+func (config *Config) Update() error {
+	config.mutex.Lock()
+	defer config.mutex.Unlock()
 
-	log.Debug("Execute config command: '%v' with args: %v", args[0], args[1:])
-	out, err := exec.Command(args[0], args[1:]...).Output()
+	out, err := config.source.Read()
 	if err != nil {
-		log.Error("Fail get config %v", err)
-		return false
+		config.logger.Error("Fail get config %v", err)
+		return err
 	}
 
 	hash := sha256.New()
 	hash.Write(out)
 	fingerprint := fmt.Sprintf("%x", hash.Sum(nil))
 	if fingerprint == config.fingerprint {
-		log.Info("Config not changed")
-		return true
+		config.logger.Info("Config not changed")
+		return nil
 	}
 
 	var conf TasksConfig
 	err = json.Unmarshal(out, &conf)
 	if err != nil {
-		log.Error("Fail parse config: %v", err)
-		return false
+		config.logger.Error("Fail parse config: %v", err)
+		return err
+	}
+
+	err = config.apply(&conf)
+	if err != nil {
+		return err
+	}
+	config.fingerprint = fingerprint
+	return nil
+}
+
+// Apply validates and applies the config bypassing the source, the next update applies the source again
+func (config *Config) Apply(conf *TasksConfig) error {
+	config.mutex.Lock()
+	defer config.mutex.Unlock()
+
+	err := config.apply(conf)
+	if err != nil {
+		return err
+	}
+	config.fingerprint = ""
+	return nil
+}
+
+func (config *Config) apply(conf *TasksConfig) error {
+	err := group.Validate(conf.Groups)
+	if err != nil {
+		config.logger.Error("Invalid groups config: %v", err)
+		return fmt.Errorf("invalid groups config: %v", err)
+	}
+
+	err = scheduler.Validate(conf.Schedule)
+	if err != nil {
+		config.logger.Error("Invalid schedule config: %v", err)
+		return fmt.Errorf("invalid schedule config: %v", err)
+	}
+
+	err = instant.Validate(conf.Instant, conf.Groups)
+	if err != nil {
+		config.logger.Error("Invalid instant config: %v", err)
+		return fmt.Errorf("invalid instant config: %v", err)
 	}
 
 	if config.onUpdate != nil {
-		config.onUpdate(&conf)
+		config.onUpdate(conf)
 	}
-	return true
+	atomic.StoreInt32(&config.applied, 1)
+	return nil
+}
+
+// IsApplied returns whether a config was applied at least once
+func (config *Config) IsApplied() bool {
+	return atomic.LoadInt32(&config.applied) == 1
 }
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mattn/go-shellwords"
+	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/task"
+)
+
+// Source returns the json of the tasks config
+type Source interface {
+	Read() ([]byte, error)
+}
+
+// SourceFunc adapts a function to the Source
+type SourceFunc func() ([]byte, error)
+
+func (fn SourceFunc) Read() ([]byte, error) {
+	return fn()
+}
+
+// Command is a source reading the output of the command
+type Command string
+
+func (command Command) Read() ([]byte, error) {
+	return CommandSource{Cmd: string(command)}.Read()
+}
+
+// CommandSource is a source reading the output of the command spawned by the runner, task.ExecRunner by default
+type CommandSource struct {
+	Cmd    string
+	Runner task.Runner
+	Logger *log.Logger
+}
+
+func (source CommandSource) Read() ([]byte, error) {
+	args, err := shellwords.Parse(source.Cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty config command")
+	}
+
+	source.Logger.Debug("Execute config command: '%v' with args: %v", args[0], args[1:])
+	var out bytes.Buffer
+	err = task.Execute(task.Spec{Args: args, Stdout: &out, Options: task.Options{Runner: source.Runner, Logger: source.Logger}}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -7,24 +7,29 @@ import (
 	"github.com/stepan-s/jobro/log"
 	"github.com/stepan-s/jobro/pool/instant"
 	"github.com/stepan-s/jobro/pool/scheduler"
+	"github.com/stepan-s/jobro/shutdown"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type Info struct {
-	Schedule []scheduler.TaskInfo `json:"schedule"`
-	Instant  []instant.PoolInfo   `json:"instant"`
+	Schedule []scheduler.TaskInfo  `json:"schedule"`
+	Instant  []instant.PoolInfo    `json:"instant"`
+	Groups   []scheduler.GroupInfo `json:"groups"`
 }
 
-func BindApi(cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, conf *config.Config, pattern string) {
-	http.HandleFunc(pattern+"/info", func(w http.ResponseWriter, r *http.Request) {
+func BindApi(mux *http.ServeMux, cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, conf *config.Config, logger *log.Logger, pattern string) {
+	mux.HandleFunc(pattern+"/info", func(w http.ResponseWriter, r *http.Request) {
 		info := Info{
 			Schedule: cronScheduler.GetInfo(),
 			Instant:  instantPool.GetInfo(),
+			Groups:   cronScheduler.GetGroups(),
 		}
 
 		res, err := json.Marshal(info)
 		if err != nil {
-			log.Error("Fail prepare json: %v", err)
+			logger.Error("Fail prepare json: %v", err)
 			w.Header().Add("X-Error", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -33,17 +38,62 @@ func BindApi(cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, con
 		w.Header().Add("Content-Type", "application/json")
 		_, err2 := w.Write(res)
 		if err2 != nil {
-			log.Error("Fail sign auth: %v", err)
+			logger.Error("Fail sign auth: %v", err)
 			w.Header().Add("X-Error", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	})
 
-	http.HandleFunc(pattern+"/reload", func(w http.ResponseWriter, r *http.Request) {
-		conf.Update()
+	mux.HandleFunc(pattern+"/workflows", func(w http.ResponseWriter, r *http.Request) {
+		res, err := json.Marshal(cronScheduler.GetWorkflows())
+		if err != nil {
+			logger.Error("Fail prepare json: %v", err)
+			w.Header().Add("X-Error", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_, err = w.Write(res)
+		if err != nil {
+			logger.Error("Fail write response: %v", err)
+		}
+	})
+
+	mux.HandleFunc(pattern+"/queue", func(w http.ResponseWriter, r *http.Request) {
+		res, err := json.Marshal(cronScheduler.GetQueue())
+		if err != nil {
+			logger.Error("Fail prepare json: %v", err)
+			w.Header().Add("X-Error", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_, err = w.Write(res)
+		if err != nil {
+			logger.Error("Fail write response: %v", err)
+		}
+	})
+
+	mux.HandleFunc(pattern+"/queue/cancel", func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.URL.Query().Get("id"))
+		if err != nil {
+			w.Header().Add("X-Error", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !cronScheduler.CancelQueued(id) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	mux.HandleFunc(pattern+"/reload", func(w http.ResponseWriter, r *http.Request) {
+		_ = conf.Update()
 	})
 
-	http.HandleFunc(pattern+"/schedule/run", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(pattern+"/schedule/run", func(w http.ResponseWriter, r *http.Request) {
 		id, err := uuid.Parse(r.URL.Query().Get("id"))
 		if err != nil {
 			w.Header().Add("X-Error", err.Error())
@@ -53,4 +103,67 @@ func BindApi(cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, con
 
 		cronScheduler.RunTask(id)
 	})
+
+	mux.HandleFunc(pattern+"/instant/scale", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		count, err := strconv.Atoi(query.Get("count"))
+		if err != nil && query.Get("count") != "" {
+			w.Header().Add("X-Error", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if query.Get("ttl") != "" {
+			ttl, err = time.ParseDuration(query.Get("ttl"))
+			if err != nil {
+				w.Header().Add("X-Error", err.Error())
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if ttl > 0 && query.Get("count") == "" {
+			w.Header().Add("X-Error", "count is required with ttl")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if count < 0 || ttl < 0 {
+			w.Header().Add("X-Error", "count and ttl must not be negative")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !instantPool.Override(query.Get("id"), count, ttl) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+type Status struct {
+	shutdown.Status
+	ScheduleRunning int64 `json:"schedule_running"`
+	InstantRunning  int64 `json:"instant_running"`
+}
+
+func BindStatus(mux *http.ServeMux, cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, progress *shutdown.Progress, logger *log.Logger, pattern string) {
+	mux.HandleFunc(pattern+"/status", func(w http.ResponseWriter, r *http.Request) {
+		status := Status{
+			Status:          progress.GetStatus(),
+			ScheduleRunning: cronScheduler.GetRunning(),
+			InstantRunning:  instantPool.GetRunning(),
+		}
+
+		res, err := json.Marshal(status)
+		if err != nil {
+			logger.Error("Fail prepare json: %v", err)
+			w.Header().Add("X-Error", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		_, err = w.Write(res)
+		if err != nil {
+			logger.Error("Fail write response: %v", err)
+		}
+	})
 }
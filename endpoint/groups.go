@@ -0,0 +1,39 @@
+package endpoint
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stepan-s/jobro/pool/scheduler"
+)
+
+// Per group metrics, collected from the scheduler on scrape
+type groupsCollector struct {
+	cronScheduler *scheduler.Scheduler
+	running       *prometheus.Desc
+	queued        *prometheus.Desc
+}
+
+func newGroupsCollector(cronScheduler *scheduler.Scheduler) *groupsCollector {
+	return &groupsCollector{
+		cronScheduler: cronScheduler,
+		running: prometheus.NewDesc(
+			"jobro_group_tasks_running",
+			"The current number running tasks in the group",
+			[]string{"group"}, nil),
+		queued: prometheus.NewDesc(
+			"jobro_group_queue_depth",
+			"The current number queued tasks runs in the group",
+			[]string{"group"}, nil),
+	}
+}
+
+func (collector *groupsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.running
+	ch <- collector.queued
+}
+
+func (collector *groupsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, info := range collector.cronScheduler.GetGroups() {
+		ch <- prometheus.MustNewConstMetric(collector.running, prometheus.GaugeValue, float64(info.Running), info.Name)
+		ch <- prometheus.MustNewConstMetric(collector.queued, prometheus.GaugeValue, float64(info.Queued), info.Name)
+	}
+}
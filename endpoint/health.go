@@ -0,0 +1,97 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"github.com/stepan-s/jobro/config"
+	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/instant"
+	"github.com/stepan-s/jobro/pool/scheduler"
+	"github.com/stepan-s/jobro/shutdown"
+	"net/http"
+	"time"
+)
+
+// How long to wait main loops
+const healthDeadline = 3 * time.Second
+
+const CheckOk = "ok"
+const CheckTimeout = "timeout"
+const CheckStopping = "stopping"
+
+type Health struct {
+	Alive  bool              `json:"alive"`
+	Checks map[string]string `json:"checks"`
+}
+
+type Readiness struct {
+	Ready         bool                    `json:"ready"`
+	State         string                  `json:"state"`
+	ConfigApplied bool                    `json:"config_applied"`
+	Pools         []instant.PoolReadiness `json:"pools"`
+}
+
+func BindHealth(mux *http.ServeMux, cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, conf *config.Config, progress *shutdown.Progress, logger *log.Logger) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		health := Health{Alive: true, Checks: map[string]string{}}
+		if progress.GetStatus().State != shutdown.StateRunning {
+			// Main loops finish on shutdown
+			health.Checks["scheduler"] = CheckStopping
+			health.Checks["instant"] = CheckStopping
+		} else {
+			health.Checks["scheduler"] = ping(cronScheduler.Ping)
+			health.Checks["instant"] = ping(instantPool.Ping)
+			for _, check := range health.Checks {
+				if check != CheckOk {
+					health.Alive = false
+				}
+			}
+		}
+		if !health.Alive {
+			logger.Error("Health check failed: %v", health.Checks)
+		}
+		writeProbe(logger, w, health, health.Alive)
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readiness := Readiness{
+			State:         progress.GetStatus().State,
+			ConfigApplied: conf.IsApplied(),
+		}
+		readiness.Ready = readiness.State == shutdown.StateRunning && readiness.ConfigApplied
+		if readiness.State == shutdown.StateRunning {
+			readiness.Pools = instantPool.GetReadiness()
+			for _, pool := range readiness.Pools {
+				if !pool.Ready && !pool.Ignored {
+					readiness.Ready = false
+				}
+			}
+		}
+		writeProbe(logger, w, readiness, readiness.Ready)
+	})
+}
+
+func ping(fn func(timeout time.Duration) bool) string {
+	if fn(healthDeadline) {
+		return CheckOk
+	}
+	return CheckTimeout
+}
+
+func writeProbe(logger *log.Logger, w http.ResponseWriter, value interface{}, ok bool) {
+	res, err := json.Marshal(value)
+	if err != nil {
+		logger.Error("Fail prepare json: %v", err)
+		w.Header().Add("X-Error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		logger.Error("Fail write response: %v", err)
+	}
+}
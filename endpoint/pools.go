@@ -0,0 +1,71 @@
+package endpoint
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stepan-s/jobro/pool/instant"
+)
+
+// Per pool metrics, collected from the instant pools on scrape
+type poolsCollector struct {
+	instantPool *instant.Pools
+	workers     *prometheus.Desc
+	maxRss      *prometheus.Desc
+	metric      *prometheus.Desc
+	desired     *prometheus.Desc
+	decisions   *prometheus.Desc
+}
+
+func newPoolsCollector(instantPool *instant.Pools) *poolsCollector {
+	return &poolsCollector{
+		instantPool: instantPool,
+		workers: prometheus.NewDesc(
+			"jobro_instant_pool_workers",
+			"The current target number of workers of the pool",
+			[]string{"pool"}, nil),
+		maxRss: prometheus.NewDesc(
+			"jobro_instant_pool_max_rss_bytes",
+			"The max resident set size of finished workers of the pool",
+			[]string{"pool"}, nil),
+		metric: prometheus.NewDesc(
+			"jobro_autoscale_metric",
+			"The last autoscale metric value of the pool",
+			[]string{"pool"}, nil),
+		desired: prometheus.NewDesc(
+			"jobro_autoscale_desired_workers",
+			"The number of workers desired by the autoscale metric",
+			[]string{"pool"}, nil),
+		decisions: prometheus.NewDesc(
+			"jobro_autoscale_decisions",
+			"The total number of autoscale count changes",
+			[]string{"pool", "direction"}, nil),
+	}
+}
+
+func (collector *poolsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.workers
+	ch <- collector.maxRss
+	ch <- collector.metric
+	ch <- collector.desired
+	ch <- collector.decisions
+}
+
+func (collector *poolsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, info := range collector.instantPool.GetInfo() {
+		// A stopping pool may have the same name as its replacement
+		if info.Stopping {
+			continue
+		}
+		name := info.Settings.GetName()
+		ch <- prometheus.MustNewConstMetric(collector.workers, prometheus.GaugeValue, float64(info.Settings.Count), name)
+		ch <- prometheus.MustNewConstMetric(collector.maxRss, prometheus.GaugeValue, float64(info.Stats.MaxRss), name)
+		if info.Autoscale == nil {
+			continue
+		}
+		if info.Autoscale.Metric != nil {
+			ch <- prometheus.MustNewConstMetric(collector.metric, prometheus.GaugeValue, *info.Autoscale.Metric, name)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.desired, prometheus.GaugeValue, float64(info.Autoscale.Desired), name)
+		ch <- prometheus.MustNewConstMetric(collector.decisions, prometheus.CounterValue, float64(info.Autoscale.ScaleUps), name, instant.ScaleUp)
+		ch <- prometheus.MustNewConstMetric(collector.decisions, prometheus.CounterValue, float64(info.Autoscale.ScaleDowns), name, instant.ScaleDown)
+	}
+}
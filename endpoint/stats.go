@@ -6,6 +6,7 @@ import (
 	"github.com/stepan-s/jobro/pool/instant"
 	"github.com/stepan-s/jobro/pool/scheduler"
 	"net/http"
+	"sync/atomic"
 )
 
 const SubjectReload = 0
@@ -18,14 +19,16 @@ type StatsTransaction struct {
 }
 
 type Stats struct {
-	inChan  chan StatsTransaction
 	reloads uint64
+	inChan  chan StatsTransaction
+	done    chan struct{}
 }
 
 func NewStats() *Stats {
 	stats := &Stats{
 		inChan:  make(chan StatsTransaction, 100),
 		reloads: 0,
+		done:    make(chan struct{}),
 	}
 	go func() {
 		for {
@@ -34,9 +37,11 @@ func NewStats() *Stats {
 				switch transaction.Subject {
 				case SubjectReload:
 					if transaction.Action == ActionIncrement {
-						stats.reloads += transaction.Value
+						atomic.AddUint64(&stats.reloads, transaction.Value)
 					}
 				}
+			case <-stats.done:
+				return
 			}
 		}
 	}()
@@ -44,32 +49,109 @@ func NewStats() *Stats {
 }
 
 func (stats *Stats) Send(transaction StatsTransaction) {
-	stats.inChan <- transaction
+	select {
+	case stats.inChan <- transaction:
+	case <-stats.done:
+	}
 }
 
-func BindMetrics(cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, stats *Stats, pattern string) {
-	prometheus.MustRegister(prometheus.NewCounterFunc(
+// Stop stops the stats loop, transactions sent after are dropped
+func (stats *Stats) Stop() {
+	close(stats.done)
+}
+
+// BindMetrics registers metrics in the registerer and serves metrics of the gatherer.
+// On error the registered metrics are unregistered and nothing is bound to the mux.
+func BindMetrics(mux *http.ServeMux, registerer prometheus.Registerer, gatherer prometheus.Gatherer, cronScheduler *scheduler.Scheduler, instantPool *instant.Pools, stats *Stats, pattern string) error {
+	var err error
+	var registered []prometheus.Collector
+	register := func(collector prometheus.Collector) {
+		if err == nil {
+			err = registerer.Register(collector)
+			if err == nil {
+				registered = append(registered, collector)
+			}
+		}
+	}
+
+	register(prometheus.NewCounterFunc(
 		prometheus.CounterOpts{
 			Name: "jobro_schedule_tasks_done",
 			Help: "The total number successfully executed tasks",
 		}, func() float64 {
 			return float64(cronScheduler.GetDone())
 		}))
-	prometheus.MustRegister(prometheus.NewCounterFunc(
+	register(prometheus.NewCounterFunc(
 		prometheus.CounterOpts{
 			Name: "jobro_schedule_tasks_failed_start",
 			Help: "The total number failed tasks starts",
 		}, func() float64 {
 			return float64(cronScheduler.GetFailed())
 		}))
-	prometheus.MustRegister(prometheus.NewCounterFunc(
+	register(prometheus.NewCounterFunc(
 		prometheus.CounterOpts{
 			Name: "jobro_schedule_tasks_errors",
 			Help: "The total number tasks executed with errors",
 		}, func() float64 {
 			return float64(cronScheduler.GetErrors())
 		}))
-	prometheus.MustRegister(prometheus.NewGaugeFunc(
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_schedule_tasks_retried",
+			Help: "The total number failed tasks runs that were retried",
+		}, func() float64 {
+			return float64(cronScheduler.GetRetried())
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_schedule_tasks_final_failures",
+			Help: "The total number tasks runs failed after all retries",
+		}, func() float64 {
+			return float64(cronScheduler.GetFinalFailed())
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_schedule_tasks_limit_killed",
+			Help: "The total number tasks killed because of resource limits",
+		}, func() float64 {
+			return float64(cronScheduler.GetLimitKilled())
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_schedule_tasks_signaled",
+			Help: "The total number tasks terminated by a signal",
+		}, func() float64 {
+			return float64(cronScheduler.GetExitStats().Signaled)
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_schedule_tasks_core_dumps",
+			Help: "The total number tasks terminated with a core dump",
+		}, func() float64 {
+			return float64(cronScheduler.GetExitStats().CoreDumps)
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_schedule_tasks_user_cpu_seconds",
+			Help: "The total user CPU time of finished tasks",
+		}, func() float64 {
+			return cronScheduler.GetExitStats().UserTime.Duration().Seconds()
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_schedule_tasks_system_cpu_seconds",
+			Help: "The total system CPU time of finished tasks",
+		}, func() float64 {
+			return cronScheduler.GetExitStats().SystemTime.Duration().Seconds()
+		}))
+	register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "jobro_schedule_tasks_max_rss_bytes",
+			Help: "The max resident set size of finished tasks",
+		}, func() float64 {
+			return float64(cronScheduler.GetExitStats().MaxRss)
+		}))
+	register(prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
 			Name: "jobro_schedule_tasks_running",
 			Help: "The current number running tasks",
@@ -77,28 +159,66 @@ func BindMetrics(cronScheduler *scheduler.Scheduler, instantPool *instant.Pools,
 			return float64(cronScheduler.GetRunning())
 		}))
 
-	prometheus.MustRegister(prometheus.NewCounterFunc(
+	register(newGroupsCollector(cronScheduler))
+	register(newPoolsCollector(instantPool))
+
+	register(prometheus.NewCounterFunc(
 		prometheus.CounterOpts{
 			Name: "jobro_instant_tasks_done",
 			Help: "The total number successfully executed tasks",
 		}, func() float64 {
 			return float64(instantPool.GetDone())
 		}))
-	prometheus.MustRegister(prometheus.NewCounterFunc(
+	register(prometheus.NewCounterFunc(
 		prometheus.CounterOpts{
 			Name: "jobro_instant_tasks_failed_start",
 			Help: "The total number failed tasks starts",
 		}, func() float64 {
 			return float64(instantPool.GetFailed())
 		}))
-	prometheus.MustRegister(prometheus.NewCounterFunc(
+	register(prometheus.NewCounterFunc(
 		prometheus.CounterOpts{
 			Name: "jobro_instant_tasks_errors",
 			Help: "The total number tasks executed with errors",
 		}, func() float64 {
 			return float64(instantPool.GetErrors())
 		}))
-	prometheus.MustRegister(prometheus.NewGaugeFunc(
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_instant_tasks_limit_killed",
+			Help: "The total number tasks killed because of resource limits",
+		}, func() float64 {
+			return float64(instantPool.GetLimitKilled())
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_instant_tasks_signaled",
+			Help: "The total number tasks terminated by a signal",
+		}, func() float64 {
+			return float64(instantPool.GetExitStats().Signaled)
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_instant_tasks_core_dumps",
+			Help: "The total number tasks terminated with a core dump",
+		}, func() float64 {
+			return float64(instantPool.GetExitStats().CoreDumps)
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_instant_tasks_user_cpu_seconds",
+			Help: "The total user CPU time of finished tasks",
+		}, func() float64 {
+			return instantPool.GetExitStats().UserTime.Duration().Seconds()
+		}))
+	register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "jobro_instant_tasks_system_cpu_seconds",
+			Help: "The total system CPU time of finished tasks",
+		}, func() float64 {
+			return instantPool.GetExitStats().SystemTime.Duration().Seconds()
+		}))
+	register(prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
 			Name: "jobro_instant_tasks_running",
 			Help: "The current number running tasks",
@@ -106,13 +226,21 @@ func BindMetrics(cronScheduler *scheduler.Scheduler, instantPool *instant.Pools,
 			return float64(instantPool.GetRunning())
 		}))
 
-	prometheus.MustRegister(prometheus.NewCounterFunc(
+	register(prometheus.NewCounterFunc(
 		prometheus.CounterOpts{
 			Name: "jobro_reloads",
 			Help: "The total number config reloads",
 		}, func() float64 {
-			return float64(stats.reloads)
+			return float64(atomic.LoadUint64(&stats.reloads))
 		}))
 
-	http.Handle(pattern, promhttp.Handler())
+	if err != nil {
+		for _, collector := range registered {
+			registerer.Unregister(collector)
+		}
+		return err
+	}
+
+	mux.Handle(pattern, promhttp.InstrumentMetricHandler(registerer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})))
+	return nil
 }
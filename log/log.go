@@ -41,6 +41,7 @@ const sNOTICE = "NOTICE"
 const sINFO = "INFO"
 const sDEBUG = "DEBUG"
 
+// Global log of the program, used by the package functions and nil loggers
 var log *Logger
 
 type Logger struct {
@@ -48,16 +49,19 @@ type Logger struct {
 	logger *stdLog.Logger
 }
 
-func Init(w io.Writer, level uint8) {
-	log = new(Logger)
+// New creates a logger, it can be passed to components instead of the global log
+func New(w io.Writer, level uint8) *Logger {
 	if level < NONE {
 		level = NONE
 	}
 	if level > DEBUG {
 		level = DEBUG
 	}
-	log.level = level
-	log.logger = stdLog.New(w, "", stdLog.LstdFlags)
+	return &Logger{level: level, logger: stdLog.New(w, "", stdLog.LstdFlags)}
+}
+
+func Init(w io.Writer, level uint8) {
+	log = New(w, level)
 }
 
 func (logger *Logger) getLogger() *stdLog.Logger {
@@ -65,7 +69,11 @@ func (logger *Logger) getLogger() *stdLog.Logger {
 }
 
 func (logger *Logger) write(level uint8, message *string, v ...interface{}) {
-	if level > logger.level {
+	// Nil logger writes to the global log, not initialized log is discarded
+	if logger == nil {
+		logger = log
+	}
+	if logger == nil || level > logger.level {
 		return
 	}
 	var levelCaption string
@@ -123,3 +131,35 @@ func Info(message string, v ...interface{}) {
 func Debug(message string, v ...interface{}) {
 	log.write(DEBUG, &message, v...)
 }
+
+func (logger *Logger) Emergency(message string, v ...interface{}) {
+	logger.write(EMERGENCY, &message, v...)
+}
+
+func (logger *Logger) Alert(message string, v ...interface{}) {
+	logger.write(ALERT, &message, v...)
+}
+
+func (logger *Logger) Critical(message string, v ...interface{}) {
+	logger.write(CRITICAL, &message, v...)
+}
+
+func (logger *Logger) Error(message string, v ...interface{}) {
+	logger.write(ERROR, &message, v...)
+}
+
+func (logger *Logger) Warning(message string, v ...interface{}) {
+	logger.write(WARNING, &message, v...)
+}
+
+func (logger *Logger) Notice(message string, v ...interface{}) {
+	logger.write(NOTICE, &message, v...)
+}
+
+func (logger *Logger) Info(message string, v ...interface{}) {
+	logger.write(INFO, &message, v...)
+}
+
+func (logger *Logger) Debug(message string, v ...interface{}) {
+	logger.write(DEBUG, &message, v...)
+}
@@ -0,0 +1,266 @@
+package jobro
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stepan-s/jobro/config"
+	"github.com/stepan-s/jobro/endpoint"
+	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/instant"
+	"github.com/stepan-s/jobro/pool/scheduler"
+	"github.com/stepan-s/jobro/pool/task"
+	"github.com/stepan-s/jobro/shutdown"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type Options struct {
+	// Source of the tasks config, it is read on Start and Reload.
+	// A config.Command is run by the Runner.
+	Config config.Source
+	// Metrics are registered here, a new registry if nil
+	Registry prometheus.Registerer
+	// Metrics served by /metrics, the registry if it is a gatherer
+	Gatherer prometheus.Gatherer
+	// Api, probes and metrics handlers are bound here, required
+	Mux *http.ServeMux
+	// Spawns processes of tasks, health checks and metric commands, task.ExecRunner by default
+	Runner task.Runner
+	// Client of http health checks and autoscale metrics, http.DefaultClient by default
+	HttpClient *http.Client
+	// Default timezone of scheduled tasks and scale rules, time.Local if nil
+	Location *time.Location
+	// File to keep scheduler state for catch-up
+	StateFile string
+	// Limit of concurrently running scheduled tasks, 0 - unlimited
+	MaxConcurrent int
+	// Default limits of queued runs per group, 0 - unlimited
+	MaxQueue     int
+	MaxQueueWait time.Duration
+	// Time to wait scheduled tasks before interrupt on stop
+	ShutdownDrain time.Duration
+	// Groups of instant pools to stop one by one before other pools
+	ShutdownOrder []string
+	// Log of the manager, its services and endpoints, the global log set up by log.Init if nil
+	Logger *log.Logger
+}
+
+// Manager runs scheduled tasks and instant pools of a config and serves their api.
+type Manager struct {
+	options   Options
+	conf      *config.Config
+	scheduler *scheduler.Scheduler
+	pools     *instant.Pools
+	progress  *shutdown.Progress
+	stats     *endpoint.Stats
+	processes *task.Registry
+	stopOnce  sync.Once
+	report    shutdown.Report
+	stopErr   error
+	done      chan struct{}
+}
+
+// How long to wait the services after processes are killed
+const killWait = 5 * time.Second
+
+// How often to kill processes respawned while the services are stopping
+const killInterval = 100 * time.Millisecond
+
+func New(options Options) (*Manager, error) {
+	if options.Mux == nil {
+		return nil, errors.New("http mux is not set")
+	}
+	if options.Registry == nil {
+		options.Registry = prometheus.NewRegistry()
+	}
+	if options.Gatherer == nil {
+		gatherer, ok := options.Registry.(prometheus.Gatherer)
+		if !ok {
+			return nil, errors.New("metrics gatherer is not set and the registry is not a gatherer")
+		}
+		options.Gatherer = gatherer
+	}
+	if options.Location == nil {
+		options.Location = time.Local
+	}
+	if command, ok := options.Config.(config.Command); ok {
+		options.Config = config.CommandSource{Cmd: string(command), Runner: options.Runner, Logger: options.Logger}
+	}
+
+	phases := []string{"triggers", "schedule"}
+	for _, name := range options.ShutdownOrder {
+		phases = append(phases, "instant:"+name)
+	}
+	phases = append(phases, "instant")
+
+	manager := &Manager{
+		options:   options,
+		conf:      config.New(options.Config, options.Logger),
+		progress:  shutdown.NewProgress(phases),
+		stats:     endpoint.NewStats(),
+		processes: task.NewRegistry(),
+		done:      make(chan struct{}),
+	}
+	manager.scheduler = scheduler.New(scheduler.Options{
+		Location:      options.Location,
+		StateFile:     options.StateFile,
+		MaxConcurrent: options.MaxConcurrent,
+		MaxQueue:      options.MaxQueue,
+		MaxWait:       options.MaxQueueWait,
+		Drain:         options.ShutdownDrain,
+		Runner:        options.Runner,
+		Registry:      manager.processes,
+		Logger:        options.Logger,
+	})
+	manager.pools = instant.New(instant.Options{
+		Location:   options.Location,
+		Runner:     options.Runner,
+		Registry:   manager.processes,
+		HttpClient: options.HttpClient,
+		Logger:     options.Logger,
+	})
+	go func() {
+		<-manager.scheduler.Done()
+		<-manager.pools.Done()
+		close(manager.done)
+	}()
+
+	// Metrics may conflict with the registry, they are bound first and the services are stopped on error,
+	// so nothing is left on the mux and New can be retried
+	mux := options.Mux
+	err := endpoint.BindMetrics(mux, options.Registry, options.Gatherer, manager.scheduler, manager.pools, manager.stats, "/metrics")
+	if err != nil {
+		_ = manager.scheduler.Stop(context.Background())
+		_ = manager.pools.Stop(context.Background())
+		manager.stats.Stop()
+		<-manager.done
+		return nil, err
+	}
+	endpoint.BindApi(mux, manager.scheduler, manager.pools, manager.conf, options.Logger, "/api")
+	endpoint.BindStatus(mux, manager.scheduler, manager.pools, manager.progress, options.Logger, "/api")
+	endpoint.BindHealth(mux, manager.scheduler, manager.pools, manager.conf, manager.progress, options.Logger)
+
+	manager.conf.SetOnUpdate(func(taskConfig *config.TasksConfig) {
+		manager.scheduler.SetTasks(taskConfig.Schedule, taskConfig.Groups)
+		manager.pools.SetTasks(taskConfig.Instant, taskConfig.Groups)
+
+		manager.stats.Send(endpoint.StatsTransaction{
+			Subject: endpoint.SubjectReload,
+			Action:  endpoint.ActionIncrement,
+			Value:   1,
+		})
+	})
+	return manager, nil
+}
+
+// Start applies the config of the source, the services keep running if it fails
+func (manager *Manager) Start() error {
+	return manager.Reload()
+}
+
+// Reload applies the config of the source if it is changed
+func (manager *Manager) Reload() error {
+	if manager.options.Config == nil {
+		return nil
+	}
+	return manager.conf.Update()
+}
+
+// Apply validates and applies the config bypassing the source
+func (manager *Manager) Apply(taskConfig config.TasksConfig) error {
+	return manager.conf.Apply(&taskConfig)
+}
+
+// Info returns the state of tasks and pools, it is empty after Stop
+func (manager *Manager) Info() endpoint.Info {
+	return endpoint.Info{
+		Schedule: manager.scheduler.GetInfo(),
+		Instant:  manager.pools.GetInfo(),
+		Groups:   manager.scheduler.GetGroups(),
+	}
+}
+
+// Stop stops triggers, scheduled tasks and instant pools in order and reports the result.
+// When the context is done the services are stopped at once, processes left are killed
+// and the context error is returned. Repeated calls return the result of the first one.
+func (manager *Manager) Stop(ctx context.Context) (shutdown.Report, error) {
+	manager.stopOnce.Do(func() {
+		manager.report, manager.stopErr = manager.shutdown(ctx)
+	})
+	return manager.report, manager.stopErr
+}
+
+// Signal sends the signal to processes of the manager in the groups, all if groups are not set
+func (manager *Manager) Signal(signal syscall.Signal, groups []string) int {
+	return manager.processes.Signal(signal, groups)
+}
+
+// Done is closed when the scheduler and the pools are stopped
+func (manager *Manager) Done() <-chan struct{} {
+	return manager.done
+}
+
+func (manager *Manager) shutdown(ctx context.Context) (shutdown.Report, error) {
+	var killed []task.KilledProcess
+	err := manager.stopPhases(ctx)
+	if err != nil {
+		manager.options.Logger.Error("Shutdown timeout reached")
+		manager.progress.Fail()
+		// Stop requests are delivered even with the done context
+		_ = manager.scheduler.Stop(ctx)
+		_ = manager.pools.Stop(ctx)
+		killed = manager.kill()
+	}
+	manager.progress.End()
+	manager.stats.Stop()
+	return manager.progress.Report(killed), err
+}
+
+func (manager *Manager) stopPhases(ctx context.Context) error {
+	manager.progress.Begin("triggers")
+	err := manager.scheduler.StopTriggers(ctx)
+	if err != nil {
+		return err
+	}
+
+	manager.progress.Begin("schedule")
+	err = manager.scheduler.Stop(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range manager.options.ShutdownOrder {
+		manager.options.Logger.Info("Stop instant pools of group '%v'", name)
+		manager.progress.Begin("instant:" + name)
+		err = manager.pools.StopGroups(ctx, []string{name})
+		if err != nil {
+			return err
+		}
+	}
+
+	manager.progress.Begin("instant")
+	return manager.pools.Stop(ctx)
+}
+
+// kill kills processes until the services are stopped, pools may respawn workers before they handle the stop
+func (manager *Manager) kill() []task.KilledProcess {
+	var killed []task.KilledProcess
+	deadline := time.After(killWait)
+	for {
+		for _, process := range manager.processes.KillAll() {
+			manager.options.Logger.Error("Force killed pid %d, group: '%v', cmd: %v", process.Pid, process.Group, process.Cmd)
+			killed = append(killed, process)
+		}
+		select {
+		case <-manager.done:
+			return killed
+		case <-deadline:
+			manager.options.Logger.Error("Services are not stopped in %v after kill", killWait)
+			return killed
+		case <-time.After(killInterval):
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package jobro
+
+import (
+	"bytes"
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stepan-s/jobro/config"
+	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/instant"
+	"github.com/stepan-s/jobro/pool/scheduler"
+	"github.com/stepan-s/jobro/pool/task"
+	"github.com/stepan-s/jobro/shutdown"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testManager struct {
+	*Manager
+	t      *testing.T
+	mux    *http.ServeMux
+	runner *task.FakeRunner
+}
+
+func newTestManager(t *testing.T, source config.Source, runner *task.FakeRunner) *testManager {
+	mux := http.NewServeMux()
+	manager, err := New(Options{
+		Config:   source,
+		Registry: prometheus.NewRegistry(),
+		Mux:      mux,
+		Runner:   runner,
+		Location: time.UTC,
+	})
+	if err != nil {
+		t.Fatalf("fail create manager: %v", err)
+	}
+	return &testManager{Manager: manager, t: t, mux: mux, runner: runner}
+}
+
+func (m *testManager) eventually(what string, condition func() bool) {
+	m.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			m.t.Fatalf("timeout waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (m *testManager) get(path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	m.mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+	return recorder.Code, string(body)
+}
+
+func TestTwoManagersInOneProcess(t *testing.T) {
+	var managers []*testManager
+	for _, name := range []string{"a", "b"} {
+		m := newTestManager(t, nil, task.NewFakeRunner())
+		err := m.Apply(config.TasksConfig{
+			Instant: []instant.PoolSettings{{Name: name, Cmd: name, Count: 1}},
+		})
+		if err != nil {
+			t.Fatalf("fail apply: %v", err)
+		}
+		managers = append(managers, m)
+	}
+
+	for i, m := range managers {
+		m.eventually("worker", func() bool {
+			return len(m.runner.Running()) == 1
+		})
+		info := m.Info()
+		if len(info.Instant) != 1 || info.Instant[0].Settings.Name != []string{"a", "b"}[i] {
+			t.Errorf("manager %d pools %+v, want only its own pool", i, info.Instant)
+		}
+		m.eventually("metrics", func() bool {
+			code, body := m.get("/metrics")
+			return code == http.StatusOK && strings.Contains(body, "jobro_instant_tasks_running 1")
+		})
+		if code, body := m.get("/api/info"); code != http.StatusOK || !strings.Contains(body, `"cmd":"`+[]string{"a", "b"}[i]+`"`) {
+			t.Errorf("manager %d info %d %v", i, code, body)
+		}
+	}
+
+	for _, m := range managers {
+		report, err := m.Stop(context.Background())
+		if err != nil || !report.Clean {
+			t.Errorf("stop error %v, report %+v", err, report)
+		}
+		if m.runner.Processes()[0].Signals()[0] != syscall.SIGINT {
+			t.Errorf("worker is not interrupted")
+		}
+	}
+}
+
+func TestMetricsGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"instance": "a"}, registry)
+	if _, err := New(Options{Registry: wrapped, Mux: http.NewServeMux()}); err == nil {
+		t.Fatalf("manager is created without a gatherer")
+	}
+
+	mux := http.NewServeMux()
+	manager, err := New(Options{Registry: wrapped, Gatherer: registry, Mux: mux})
+	if err != nil {
+		t.Fatalf("fail create manager: %v", err)
+	}
+	m := &testManager{Manager: manager, t: t, mux: mux}
+	if code, body := m.get("/metrics"); code != http.StatusOK || !strings.Contains(body, `instance="a"`) {
+		t.Errorf("metrics %d %v, want metrics of the registry", code, body)
+	}
+	_, _ = m.Stop(context.Background())
+}
+
+func TestNewRetryAfterMetricsConflict(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Errorf("manager is created without a mux")
+	}
+
+	registry := prometheus.NewRegistry()
+	conflict := prometheus.NewGauge(prometheus.GaugeOpts{Name: "jobro_schedule_tasks_running", Help: "The current number running tasks"})
+	registry.MustRegister(conflict)
+	mux := http.NewServeMux()
+	if _, err := New(Options{Registry: registry, Mux: mux}); err == nil {
+		t.Fatalf("manager is created with conflicting metrics")
+	}
+
+	registry.Unregister(conflict)
+	manager, err := New(Options{Registry: registry, Mux: mux})
+	if err != nil {
+		t.Fatalf("fail create manager on retry: %v", err)
+	}
+	m := &testManager{Manager: manager, t: t, mux: mux}
+	if code, body := m.get("/metrics"); code != http.StatusOK || !strings.Contains(body, "jobro_schedule_tasks_done") {
+		t.Errorf("metrics %d %v, want metrics of the manager", code, body)
+	}
+	if code, _ := m.get("/api/status"); code != http.StatusOK {
+		t.Errorf("status %d, want ok", code)
+	}
+	_, _ = manager.Stop(context.Background())
+}
+
+func TestMetricsSkipStoppingPools(t *testing.T) {
+	runner := task.NewFakeRunner()
+	runner.Ignore[syscall.SIGINT] = true
+	m := newTestManager(t, nil, runner)
+	apply := func(version string) {
+		err := m.Apply(config.TasksConfig{
+			Instant: []instant.PoolSettings{{Cmd: "worker", Count: 1, SpawnSettings: task.SpawnSettings{Env: map[string]string{"VERSION": version}}}},
+		})
+		if err != nil {
+			t.Fatalf("fail apply: %v", err)
+		}
+	}
+	apply("1")
+	m.eventually("worker", func() bool {
+		return len(m.runner.Running()) == 1
+	})
+	// The old pool with the same cmd keeps stopping next to its replacement
+	apply("2")
+	m.eventually("replacement", func() bool {
+		return len(m.runner.Running()) == 2 && len(m.Info().Instant) == 2
+	})
+	code, body := m.get("/metrics")
+	if code != http.StatusOK || strings.Count(body, `jobro_instant_pool_workers{pool="worker"}`) != 1 || strings.Count(body, `jobro_instant_pool_max_rss_bytes{pool="worker"}`) != 1 {
+		t.Errorf("metrics %d %v, want the replacement pool only", code, body)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _ = m.Stop(ctx)
+}
+
+func TestStartReadsSource(t *testing.T) {
+	source := config.SourceFunc(func() ([]byte, error) {
+		return []byte(`{"instant": [{"name": "a", "cmd": "worker", "count": 2}]}`), nil
+	})
+	m := newTestManager(t, source, task.NewFakeRunner())
+	if err := m.Start(); err != nil {
+		t.Fatalf("fail start: %v", err)
+	}
+	m.eventually("workers", func() bool {
+		return len(m.runner.Running()) == 2
+	})
+	if code, _ := m.get("/readyz"); code != http.StatusOK {
+		t.Errorf("readiness %d, want ready", code)
+	}
+	_, _ = m.Stop(context.Background())
+}
+
+func TestConfigCommandByRunner(t *testing.T) {
+	runner := task.NewFakeRunner()
+	runner.OnSpawn = func(process *task.FakeProcess) {
+		if process.Spec.Args[0] == "print-config" {
+			_, _ = io.WriteString(process.Spec.Stdout, `{"instant": [{"name": "a", "cmd": "worker", "count": 1}]}`)
+			_ = process.Exit(0)
+		}
+	}
+	m := newTestManager(t, config.Command("print-config --env test"), runner)
+	if err := m.Start(); err != nil {
+		t.Fatalf("fail start: %v", err)
+	}
+	m.eventually("worker", func() bool {
+		return len(runner.Running()) == 1 && runner.Running()[0].Spec.Args[0] == "worker"
+	})
+	_, _ = m.Stop(context.Background())
+}
+
+func TestApplyInvalidConfig(t *testing.T) {
+	m := newTestManager(t, nil, task.NewFakeRunner())
+	err := m.Apply(config.TasksConfig{
+		Schedule: []scheduler.TaskSettings{{Name: "a", Cron: "manual", Cmd: "a", Timezone: "Nowhere/City"}},
+	})
+	if err == nil {
+		t.Errorf("invalid config is applied")
+	}
+	if code, _ := m.get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readiness %d without config, want unavailable", code)
+	}
+	_, _ = m.Stop(context.Background())
+}
+
+// lockedBuffer is written by the loops of the services and read by the test
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestLogger(t *testing.T) {
+	var out lockedBuffer
+	manager, err := New(Options{
+		Registry: prometheus.NewRegistry(),
+		Mux:      http.NewServeMux(),
+		Runner:   task.NewFakeRunner(),
+		Location: time.UTC,
+		Logger:   log.New(&out, log.INFO),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.Apply(config.TasksConfig{
+		Schedule: []scheduler.TaskSettings{{Name: "a", Cron: "manual", Cmd: "a"}},
+		Instant:  []instant.PoolSettings{{Name: "b", Cmd: "b", Count: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = manager.Apply(config.TasksConfig{
+		Schedule: []scheduler.TaskSettings{{Name: "a", Cron: "manual", Cmd: "a", Timezone: "Nowhere/City"}},
+	})
+	_, _ = manager.Stop(context.Background())
+
+	for _, message := range []string{"Add task", "Add instant pool b", "Invalid schedule config", "Scheduler stop tasks"} {
+		if !strings.Contains(out.String(), message) {
+			t.Errorf("log has no %q:\n%v", message, out.String())
+		}
+	}
+}
+
+func TestStopKillsOnContextDone(t *testing.T) {
+	runner := task.NewFakeRunner()
+	runner.Ignore[syscall.SIGINT] = true
+	m := newTestManager(t, nil, runner)
+	_ = m.Apply(config.TasksConfig{
+		Instant: []instant.PoolSettings{{Name: "a", Cmd: "a", Count: 1}},
+	})
+	m.eventually("worker", func() bool {
+		return len(runner.Running()) == 1
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err := m.Stop(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("stop error %v, want deadline exceeded", err)
+	}
+	worker := runner.Processes()[0]
+	if signals := worker.Signals(); len(signals) < 2 || signals[len(signals)-1] != syscall.SIGKILL {
+		t.Errorf("signals %v, want interrupt and kill", signals)
+	}
+	if report.Clean || len(report.Killed) != 1 || report.Killed[0].Pid != worker.Pid() {
+		t.Errorf("report %+v, want the killed worker", report)
+	}
+	statuses := map[string]string{}
+	for _, phase := range report.Phases {
+		statuses[phase.Name] = phase.Status
+	}
+	if statuses["schedule"] != shutdown.PhaseDone || statuses["instant"] != shutdown.PhaseTimeout {
+		t.Errorf("phases %v, want the instant phase timed out", statuses)
+	}
+	select {
+	case <-m.Done():
+	default:
+		t.Errorf("services are not stopped after kill")
+	}
+	if again, _ := m.Stop(context.Background()); len(again.Killed) != 1 {
+		t.Errorf("repeated stop report %+v differs", again)
+	}
+	if info := m.Info(); info.Instant != nil {
+		t.Errorf("info after stop %+v, want empty", info)
+	}
+}
+
+func TestStopKillsOnlyOwnProcesses(t *testing.T) {
+	stuck := task.NewFakeRunner()
+	stuck.Ignore[syscall.SIGINT] = true
+	stuck.Ignore[syscall.SIGHUP] = true
+	a := newTestManager(t, nil, stuck)
+	b := newTestManager(t, nil, task.NewFakeRunner())
+	for _, m := range []*testManager{a, b} {
+		_ = m.Apply(config.TasksConfig{
+			Instant: []instant.PoolSettings{{Name: "w", Cmd: "w", Count: 1}},
+		})
+		m.eventually("worker", func() bool {
+			return len(m.runner.Running()) == 1
+		})
+	}
+	other := b.runner.Processes()[0]
+
+	if count := a.Signal(syscall.SIGHUP, nil); count != 1 {
+		t.Errorf("signal sent to %d processes, want 1", count)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err := a.Stop(ctx)
+	if err != context.DeadlineExceeded || len(report.Killed) != 1 {
+		t.Errorf("stop error %v report %+v, want the own worker killed", err, report)
+	}
+	if other.Exited() || len(other.Signals()) != 0 {
+		t.Errorf("worker of the other manager got signals %v", other.Signals())
+	}
+	if info := b.Info(); len(info.Instant) != 1 || info.Instant[0].Stats.Running != 1 {
+		t.Errorf("other manager pools %+v, want the worker running", info.Instant)
+	}
+	_, _ = b.Stop(context.Background())
+}
+
+func TestStopOrderedGroups(t *testing.T) {
+	runner := task.NewFakeRunner()
+	mux := http.NewServeMux()
+	manager, err := New(Options{
+		Registry:      prometheus.NewRegistry(),
+		Mux:           mux,
+		Runner:        runner,
+		ShutdownOrder: []string{"consumers"},
+	})
+	if err != nil {
+		t.Fatalf("fail create manager: %v", err)
+	}
+	m := &testManager{Manager: manager, t: t, mux: mux, runner: runner}
+	_ = m.Apply(config.TasksConfig{
+		Instant: []instant.PoolSettings{
+			{Name: "consumer", Cmd: "consumer", Count: 1, Group: "consumers"},
+			{Name: "producer", Cmd: "producer", Count: 1, Group: "producers"},
+		},
+	})
+	m.eventually("workers", func() bool {
+		return len(runner.Running()) == 2
+	})
+	consumer, producer := runner.Processes()[0], runner.Processes()[1]
+	if consumer.Spec.Args[0] != "consumer" {
+		consumer, producer = producer, consumer
+	}
+
+	report, err := m.Stop(context.Background())
+	if err != nil || !report.Clean {
+		t.Fatalf("stop error %v, report %+v", err, report)
+	}
+	var names []string
+	for _, phase := range report.Phases {
+		names = append(names, phase.Name)
+	}
+	if strings.Join(names, ",") != "triggers,schedule,instant:consumers,instant" {
+		t.Errorf("phases %v", names)
+	}
+	consumers, rest := report.Phases[2], report.Phases[3]
+	if consumers.Finished.After(*rest.Started) {
+		t.Errorf("consumers are stopped after the instant phase start")
+	}
+	if !consumer.Exited() || !producer.Exited() {
+		t.Errorf("workers are not stopped")
+	}
+}
@@ -0,0 +1,67 @@
+package group
+
+import (
+	"fmt"
+	"github.com/stepan-s/jobro/pool/task"
+	"time"
+)
+
+// What to do with a run when there is no free slot
+const PolicyQueue = "queue"
+const PolicySkip = "skip"
+
+type Settings struct {
+	MaxConcurrent int           `json:"max_concurrent"`
+	Policy        string        `json:"policy"`
+	MaxQueue      int           `json:"max_queue"`
+	MaxWait       task.Duration `json:"max_wait"`
+	Readiness     Readiness     `json:"readiness"`
+}
+
+// Defaults of crash loop detection
+const defaultCrashLoopRestarts = 5
+const defaultCrashLoopWindow = time.Minute
+
+// Readiness rules of instant pools of the group
+type Readiness struct {
+	// Minimum running workers of each pool, if not set in the pool
+	MinReady int `json:"min_ready"`
+	// Pool is in crash loop after this number of failures in the window
+	CrashLoopRestarts int           `json:"crash_loop_restarts"`
+	CrashLoopWindow   task.Duration `json:"crash_loop_window"`
+	// Pools of the group do not affect readiness
+	Ignore bool `json:"ignore"`
+}
+
+func (readiness Readiness) GetCrashLoopRestarts() int {
+	if readiness.CrashLoopRestarts <= 0 {
+		return defaultCrashLoopRestarts
+	}
+	return readiness.CrashLoopRestarts
+}
+
+func (readiness Readiness) GetCrashLoopWindow() time.Duration {
+	if readiness.CrashLoopWindow <= 0 {
+		return defaultCrashLoopWindow
+	}
+	return readiness.CrashLoopWindow.Duration()
+}
+
+// Validate checks the groups settings before applying
+func Validate(groups map[string]Settings) error {
+	for name, settings := range groups {
+		switch settings.Policy {
+		case "", PolicyQueue, PolicySkip:
+		default:
+			return fmt.Errorf("group %v: unknown policy %q", name, settings.Policy)
+		}
+	}
+	return nil
+}
+
+func (settings Settings) GetPolicy() string {
+	if settings.Policy == "" {
+		return PolicyQueue
+	}
+	return settings.Policy
+}
@@ -0,0 +1,14 @@
+package group
+
+import (
+	"testing"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	for policy, valid := range map[string]bool{"": true, PolicyQueue: true, PolicySkip: true, "drop": false, "Queue": false} {
+		err := Validate(map[string]Settings{"heavy": {MaxConcurrent: 1, Policy: policy}})
+		if (err == nil) != valid {
+			t.Errorf("policy %q: unexpected error %v", policy, err)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package instant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-shellwords"
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/pool/task"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of autoscaling
+const defaultAutoscaleInterval = 15 * time.Second
+const defaultAutoscaleTimeout = 10 * time.Second
+const defaultScaleUpCooldown = 30 * time.Second
+const defaultScaleDownCooldown = 5 * time.Minute
+
+const ScaleUp = "up"
+const ScaleDown = "down"
+
+// Workers count driven by a metric, the count is metric / target_per_worker within min and max
+type Autoscale struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+	// Command printing the metric
+	Command string `json:"command"`
+	// Url of JSON document and dotted path to the metric, like "queues.orders.backlog"
+	Url               string        `json:"url"`
+	Path              string        `json:"path"`
+	TargetPerWorker   float64       `json:"target_per_worker"`
+	Interval          task.Duration `json:"interval"`
+	Timeout           task.Duration `json:"timeout"`
+	ScaleUpCooldown   task.Duration `json:"scale_up_cooldown"`
+	ScaleDownCooldown task.Duration `json:"scale_down_cooldown"`
+}
+
+// Autoscaling state of a pool
+type AutoscaleInfo struct {
+	Metric     *float64   `json:"metric,omitempty"`
+	Desired    int        `json:"desired"`
+	LastCheck  *time.Time `json:"last_check,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	LastScale  *time.Time `json:"last_scale,omitempty"`
+	ScaleUps   int64      `json:"scale_ups"`
+	ScaleDowns int64      `json:"scale_downs"`
+}
+
+type AutoscaleResult struct {
+	metric float64
+	err    error
+}
+
+func (autoscale *Autoscale) Validate() error {
+	if autoscale.Min < 0 || autoscale.Max < autoscale.Min || autoscale.Max == 0 {
+		return errors.New("autoscale requires 0 <= min <= max and max > 0")
+	}
+	if autoscale.TargetPerWorker <= 0 {
+		return errors.New("autoscale target_per_worker must be positive")
+	}
+	if (autoscale.Command == "") == (autoscale.Url == "") {
+		return errors.New("autoscale requires one of command or url")
+	}
+	if autoscale.Url != "" && autoscale.Path == "" {
+		return errors.New("autoscale url requires path")
+	}
+	if autoscale.Command != "" {
+		args, err := shellwords.Parse(autoscale.Command)
+		if err != nil {
+			return fmt.Errorf("autoscale command: %v", err)
+		}
+		if len(args) == 0 {
+			return errors.New("autoscale command is empty")
+		}
+	}
+	return nil
+}
+
+func (autoscale *Autoscale) getInterval() time.Duration {
+	if autoscale.Interval <= 0 {
+		return defaultAutoscaleInterval
+	}
+	return autoscale.Interval.Duration()
+}
+
+func (autoscale *Autoscale) getTimeout() time.Duration {
+	if autoscale.Timeout <= 0 {
+		return defaultAutoscaleTimeout
+	}
+	return autoscale.Timeout.Duration()
+}
+
+func (autoscale *Autoscale) getScaleUpCooldown() time.Duration {
+	if autoscale.ScaleUpCooldown <= 0 {
+		return defaultScaleUpCooldown
+	}
+	return autoscale.ScaleUpCooldown.Duration()
+}
+
+func (autoscale *Autoscale) getScaleDownCooldown() time.Duration {
+	if autoscale.ScaleDownCooldown <= 0 {
+		return defaultScaleDownCooldown
+	}
+	return autoscale.ScaleDownCooldown.Duration()
+}
+
+func (autoscale *Autoscale) clamp(count int) int {
+	if count < autoscale.Min {
+		return autoscale.Min
+	}
+	if count > autoscale.Max {
+		return autoscale.Max
+	}
+	return count
+}
+
+func (autoscale *Autoscale) desired(metric float64) int {
+	return autoscale.clamp(int(math.Ceil(metric / autoscale.TargetPerWorker)))
+}
+
+// fetch runs the command by the runner or requests the url by the client
+func (autoscale *Autoscale) fetch(runner task.Runner, clk clock.Clock, client *http.Client) (float64, error) {
+	if autoscale.Command != "" {
+		args, err := shellwords.Parse(autoscale.Command)
+		if err != nil {
+			return 0, err
+		}
+		if len(args) == 0 {
+			return 0, errors.New("empty autoscale command")
+		}
+		var out bytes.Buffer
+		spec := task.Spec{Args: args, Stdout: &out, Options: task.Options{Runner: runner, Clock: clk}}
+		if err := task.Execute(spec, autoscale.getTimeout()); err != nil {
+			return 0, err
+		}
+		return strconv.ParseFloat(strings.TrimSpace(out.String()), 64)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), autoscale.getTimeout())
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, autoscale.Url, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return 0, fmt.Errorf("status %d", res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+	var doc interface{}
+	err = json.Unmarshal(body, &doc)
+	if err != nil {
+		return 0, err
+	}
+	return jsonPath(doc, autoscale.Path)
+}
+
+// jsonPath finds the number by dotted path, array items are addressed by index
+func jsonPath(doc interface{}, path string) (float64, error) {
+	value := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return 0, fmt.Errorf("path %v not found", path)
+			}
+			value = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return 0, fmt.Errorf("path %v not found", path)
+			}
+			value = node[i]
+		default:
+			return 0, fmt.Errorf("path %v not found", path)
+		}
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("value of %v is not a number", path)
+}
+
+// startAutoscaler fetches the metric periodically, close the returned channel to stop
+func startAutoscaler(autoscale *Autoscale, clk clock.Clock, runner task.Runner, client *http.Client, results chan AutoscaleResult) chan bool {
+	stop := make(chan bool)
+	go func() {
+		ticker := clk.NewTicker(autoscale.getInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C():
+				metric, err := autoscale.fetch(runner, clk, client)
+				select {
+				case results <- AutoscaleResult{metric, err}:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+	return stop
+}
+
+// autoscale applies the metric to the workers count
+func (pool *Pool) autoscale(result AutoscaleResult) {
+	autoscale := pool.Settings.Autoscale
+	if autoscale == nil {
+		return
+	}
+	info := pool.autoscaleInfo
+	now := pool.clock.Now()
+	info.LastCheck = &now
+	if result.err != nil {
+		info.LastError = result.err.Error()
+		pool.logger.Error("Instant pool %v autoscale metric error: %v", pool.Settings.Cmd, result.err)
+		pool.setAutoscaleInfo(info)
+		return
+	}
+	metric := result.metric
+	info.Metric = &metric
+	info.LastError = ""
+	info.Desired = autoscale.desired(metric)
+
+	count := pool.baseCount
+	var since time.Duration = math.MaxInt64
+	if info.LastScale != nil {
+		since = now.Sub(*info.LastScale)
+	}
+	switch {
+	case info.Desired > count && since >= autoscale.getScaleUpCooldown():
+		info.ScaleUps += 1
+	case info.Desired < count && since >= autoscale.getScaleDownCooldown():
+		info.ScaleDowns += 1
+	default:
+		pool.setAutoscaleInfo(info)
+		return
+	}
+	info.LastScale = &now
+	pool.logger.Info("Instant pool %v autoscale %d -> %d, metric: %v, target per worker: %v", pool.Settings.Cmd, count, info.Desired, metric, autoscale.TargetPerWorker)
+	pool.setAutoscaleInfo(info)
+	pool.baseCount = info.Desired
+	pool.applyCount()
+}
+
+func (pool *Pool) setAutoscaleInfo(info AutoscaleInfo) {
+	pool.autoscaleInfo = info
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	if pool.Settings.Autoscale == nil {
+		pool.autoscaleShared = nil
+		return
+	}
+	pool.autoscaleShared = &info
+}
+
+func (pool *Pool) getAutoscale() *AutoscaleInfo {
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	return pool.autoscaleShared
+}
+
+// restartAutoscaler applies autoscale settings
+func (pool *Pool) restartAutoscaler() {
+	if pool.autoscaleStop != nil {
+		close(pool.autoscaleStop)
+		pool.autoscaleStop = nil
+	}
+	if pool.Settings.Autoscale != nil {
+		pool.autoscaleStop = startAutoscaler(pool.Settings.Autoscale, pool.clock, pool.runner, pool.client, pool.autoscaleChan)
+	}
+	pool.setAutoscaleInfo(pool.autoscaleInfo)
+}
@@ -0,0 +1,101 @@
+package instant
+
+import (
+	"encoding/json"
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/pool/task"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJsonPath(t *testing.T) {
+	var doc interface{}
+	err := json.Unmarshal([]byte(`{
+		"queues": {"orders": {"backlog": 42, "text": "7.5", "name": "orders"}},
+		"list": [{"depth": 3}, {"depth": 5}],
+		"flag": true
+	}`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path  string
+		value float64
+		err   bool
+	}{
+		{"queues.orders.backlog", 42, false},
+		{"queues.orders.text", 7.5, false},
+		{"list.1.depth", 5, false},
+		{"queues.orders.name", 0, true},
+		{"queues.orders", 0, true},
+		{"queues.missing", 0, true},
+		{"list.2.depth", 0, true},
+		{"list.-1.depth", 0, true},
+		{"list.first", 0, true},
+		{"flag", 0, true},
+		{"flag.value", 0, true},
+	}
+	for _, c := range cases {
+		value, err := jsonPath(doc, c.path)
+		if (err != nil) != c.err || value != c.value {
+			t.Errorf("%v: value %v error %v, want %v error %v", c.path, value, err, c.value, c.err)
+		}
+	}
+}
+
+func TestAutoscaleDesired(t *testing.T) {
+	autoscale := &Autoscale{Min: 1, Max: 10, TargetPerWorker: 100}
+	cases := []struct {
+		metric  float64
+		desired int
+	}{
+		{0, 1},
+		{-50, 1},
+		{100, 1},
+		{101, 2},
+		{550, 6},
+		{1000, 10},
+		{5000, 10},
+	}
+	for _, c := range cases {
+		if desired := autoscale.desired(c.metric); desired != c.desired {
+			t.Errorf("metric %v: desired %d, want %d", c.metric, desired, c.desired)
+		}
+	}
+
+	zero := &Autoscale{Min: 0, Max: 3, TargetPerWorker: 0.5}
+	if desired := zero.desired(0); desired != 0 {
+		t.Errorf("desired %d for no metric, want scale to zero", desired)
+	}
+	if desired := zero.desired(1.2); desired != 3 {
+		t.Errorf("desired %d for fractional target, want 3", desired)
+	}
+}
+
+func TestFetchByRunnerAndClient(t *testing.T) {
+	runner := task.NewFakeRunner()
+	runner.OnSpawn = func(process *task.FakeProcess) {
+		_, _ = io.WriteString(process.Spec.Stdout, "7\n")
+		_ = process.Exit(0)
+	}
+	byCommand := &Autoscale{Command: "queue-depth orders"}
+	metric, err := byCommand.fetch(runner, clock.NewFake(testStart), nil)
+	if err != nil || metric != 7 {
+		t.Errorf("command metric %v, error %v, want 7", metric, err)
+	}
+	if args := runner.Processes()[0].Spec.Args; len(args) != 2 || args[0] != "queue-depth" {
+		t.Errorf("command args %v", args)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"queues": {"orders": {"backlog": 42}}}`)
+	}))
+	defer server.Close()
+	byUrl := &Autoscale{Url: server.URL, Path: "queues.orders.backlog"}
+	metric, err = byUrl.fetch(nil, clock.Real, server.Client())
+	if err != nil || metric != 42 {
+		t.Errorf("url metric %v, error %v, want 42", metric, err)
+	}
+}
@@ -0,0 +1,34 @@
+package instant
+
+import (
+	"github.com/stepan-s/jobro/pool/task"
+	"time"
+)
+
+// How many last worker exits to keep per pool
+const exitsLimit = 20
+
+type WorkerExit struct {
+	Pid   int       `json:"pid"`
+	Index int       `json:"index"`
+	Time  time.Time `json:"time"`
+	task.Exit
+}
+
+func (pool *Pool) addExit(index int, pid int, exit *task.Exit) {
+	if exit == nil {
+		return
+	}
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	pool.exits = append(pool.exits, WorkerExit{Pid: pid, Index: index, Time: pool.clock.Now(), Exit: *exit})
+	if len(pool.exits) > exitsLimit {
+		pool.exits = pool.exits[len(pool.exits)-exitsLimit:]
+	}
+}
+
+func (pool *Pool) getExits() []WorkerExit {
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	return append([]WorkerExit{}, pool.exits...)
+}
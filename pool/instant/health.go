@@ -0,0 +1,261 @@
+package instant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-shellwords"
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/pool/task"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of health checks
+const defaultHealthInterval = 10 * time.Second
+const defaultHealthTimeout = 5 * time.Second
+const defaultFailureThreshold = 3
+
+const HealthStarting = "starting"
+const HealthHealthy = "healthy"
+const HealthUnhealthy = "unhealthy"
+
+// Health check of a worker, one of exec, http or tcp
+type HealthCheck struct {
+	// Command, the worker pid is passed in JOBRO_WORKER_PID
+	Exec string `json:"exec"`
+	// Url to GET, 2xx and 3xx statuses are healthy
+	Http string `json:"http"`
+	// Address to connect
+	Tcp              string        `json:"tcp"`
+	Interval         task.Duration `json:"interval"`
+	Timeout          task.Duration `json:"timeout"`
+	FailureThreshold int           `json:"failure_threshold"`
+}
+
+func (check *HealthCheck) Validate() error {
+	count := 0
+	for _, target := range []string{check.Exec, check.Http, check.Tcp} {
+		if target != "" {
+			count += 1
+		}
+	}
+	if count != 1 {
+		return errors.New("health check requires one of exec, http or tcp")
+	}
+	for _, target := range []string{check.Exec, check.Http, check.Tcp} {
+		if _, err := task.ExpandCmd(target, WorkerVars{}); err != nil {
+			return fmt.Errorf("health check template: %v", err)
+		}
+	}
+	if check.Exec != "" {
+		args, err := shellwords.Parse(check.Exec)
+		if err != nil {
+			return fmt.Errorf("health check exec: %v", err)
+		}
+		if len(args) == 0 {
+			return errors.New("health check exec is empty")
+		}
+	}
+	return nil
+}
+
+func (check *HealthCheck) getInterval() time.Duration {
+	if check.Interval <= 0 {
+		return defaultHealthInterval
+	}
+	return check.Interval.Duration()
+}
+
+func (check *HealthCheck) getTimeout() time.Duration {
+	if check.Timeout <= 0 {
+		return defaultHealthTimeout
+	}
+	return check.Timeout.Duration()
+}
+
+func (check *HealthCheck) getFailureThreshold() int {
+	if check.FailureThreshold <= 0 {
+		return defaultFailureThreshold
+	}
+	return check.FailureThreshold
+}
+
+// probe runs the check command by the runner, http checks use the client
+func (h *health) probe(check *HealthCheck, pid int, vars WorkerVars) error {
+	ctx, cancel := context.WithTimeout(context.Background(), check.getTimeout())
+	defer cancel()
+	switch {
+	case check.Exec != "":
+		line, err := task.ExpandCmd(check.Exec, vars)
+		if err != nil {
+			return err
+		}
+		args, err := shellwords.Parse(line)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			return errors.New("empty health check command")
+		}
+		return task.Execute(task.Spec{
+			Args: args,
+			Env: []string{
+				"JOBRO_WORKER_PID=" + strconv.Itoa(pid),
+				"JOBRO_WORKER_INDEX=" + strconv.Itoa(vars.Index),
+				"JOBRO_WORKER_COUNT=" + strconv.Itoa(vars.Count),
+			},
+			Options: task.Options{Runner: h.runner, Clock: h.clock},
+		}, check.getTimeout())
+	case check.Http != "":
+		url, err := task.ExpandCmd(check.Http, vars)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := h.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode >= 400 {
+			return fmt.Errorf("status %d", res.StatusCode)
+		}
+		return nil
+	default:
+		address, err := task.ExpandCmd(check.Tcp, vars)
+		if err != nil {
+			return err
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+type HealthResult struct {
+	pid int
+	err error
+}
+
+// Health of a worker process
+type WorkerHealth struct {
+	Pid       int        `json:"pid"`
+	Index     int        `json:"index"`
+	Status    string     `json:"status"`
+	Failures  int        `json:"failures"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	stop      chan bool
+}
+
+// Health checks of pool workers
+type health struct {
+	mutex   sync.Mutex
+	clock   clock.Clock
+	runner  task.Runner
+	client  *http.Client
+	workers map[int]*WorkerHealth
+}
+
+func (h *health) start(check *HealthCheck, pid int, vars WorkerVars, results chan HealthResult) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.workers == nil {
+		h.workers = map[int]*WorkerHealth{}
+	}
+	worker := &WorkerHealth{Pid: pid, Index: vars.Index, Status: HealthStarting, stop: make(chan bool)}
+	h.workers[pid] = worker
+	if check == nil {
+		return
+	}
+	go func() {
+		ticker := h.clock.NewTicker(check.getInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-worker.stop:
+				return
+			case <-ticker.C():
+				err := h.probe(check, pid, vars)
+				select {
+				case results <- HealthResult{pid, err}:
+				case <-worker.stop:
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (h *health) stop(pid int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if worker, ok := h.workers[pid]; ok {
+		close(worker.stop)
+		delete(h.workers, pid)
+	}
+}
+
+// update applies the check result, returns true when the worker became unhealthy
+func (h *health) update(result HealthResult, threshold int) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	worker, ok := h.workers[result.pid]
+	if !ok {
+		return false
+	}
+	now := h.clock.Now()
+	worker.LastCheck = &now
+	if result.err == nil {
+		worker.Status = HealthHealthy
+		worker.Failures = 0
+		worker.LastError = ""
+		return false
+	}
+	worker.Failures += 1
+	worker.LastError = result.err.Error()
+	if worker.Failures >= threshold && worker.Status != HealthUnhealthy {
+		worker.Status = HealthUnhealthy
+		return true
+	}
+	return false
+}
+
+// list returns workers ordered by slot index
+func (h *health) list() []WorkerHealth {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var list []WorkerHealth
+	for _, worker := range h.workers {
+		list = append(list, *worker)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Index != list[j].Index {
+			return list[i].Index < list[j].Index
+		}
+		return list[i].Pid < list[j].Pid
+	})
+	return list
+}
+
+func (h *health) pids() []int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var pids []int
+	for pid := range h.workers {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
@@ -0,0 +1,80 @@
+package instant
+
+import (
+	"github.com/stepan-s/jobro/pool/task"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUnhealthyWorkerRestarts(t *testing.T) {
+	p := newTestPools(t)
+	// The check command runs by the runner and fails at once
+	probes := make(chan *task.FakeProcess, 10)
+	p.runner.OnSpawn = func(process *task.FakeProcess) {
+		if process.Spec.Args[0] == "false" {
+			probes <- process
+			_ = process.Exit(1)
+		}
+	}
+	p.SetTasks([]PoolSettings{{
+		Name:        "a",
+		Cmd:         "a",
+		Count:       1,
+		HealthCheck: &HealthCheck{Exec: "false", Interval: task.Duration(time.Second), FailureThreshold: 2},
+	}}, nil)
+	old := p.waitRunning("a", 1)[0]
+	// The recycle ticker and the health check ticker
+	p.eventually("health ticker", func() bool {
+		return p.clock.Timers() == 2
+	})
+	failures := func(n int) func() bool {
+		return func() bool {
+			workers := p.info("a").Workers
+			return len(workers) == 1 && workers[0].Failures == n
+		}
+	}
+
+	p.clock.Advance(time.Second)
+	p.eventually("first failure", failures(1))
+	if old.Exited() {
+		t.Fatalf("worker is restarted before the threshold")
+	}
+	if probe := <-probes; env(probe, "JOBRO_WORKER_PID") != strconv.Itoa(old.Pid()) {
+		t.Errorf("check env %v, want the worker pid", probe.Spec.Env)
+	}
+
+	p.clock.Advance(time.Second)
+	p.eventually("restart", func() bool {
+		return old.Exited() && p.info("a").Stats.Unhealthy == 1
+	})
+	restarted := p.waitRunning("a", 1)[0]
+	if restarted == old {
+		t.Errorf("unhealthy worker is not replaced")
+	}
+	if workers := p.info("a").Workers; len(workers) != 1 || workers[0].Pid != restarted.Pid() || workers[0].Status != HealthStarting {
+		t.Errorf("workers %+v, want a new starting worker", workers)
+	}
+	p.stop()
+}
+
+func TestWorkersOrderedByIndex(t *testing.T) {
+	h := health{workers: map[int]*WorkerHealth{}}
+	for i, index := range []int{2, 0, 3, 1, 0} {
+		pid := 100 - i
+		h.workers[pid] = &WorkerHealth{Pid: pid, Index: index}
+	}
+	var order []int
+	for _, worker := range h.list() {
+		order = append(order, worker.Index)
+	}
+	want := []int{0, 0, 1, 2, 3}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("worker indexes %v, want %v", order, want)
+		}
+	}
+	if list := h.list(); list[0].Pid > list[1].Pid {
+		t.Errorf("workers of one slot %+v are not ordered by pid", list[:2])
+	}
+}
@@ -0,0 +1,120 @@
+package instant
+
+import (
+	"context"
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/pool/task"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type testPools struct {
+	*Pools
+	t      *testing.T
+	clock  *clock.Fake
+	runner *task.FakeRunner
+}
+
+func newTestPools(t *testing.T) *testPools {
+	fake := clock.NewFake(testStart)
+	runner := task.NewFakeRunner()
+	return &testPools{
+		Pools:  New(Options{Location: time.UTC, Runner: runner, Clock: fake}),
+		t:      t,
+		clock:  fake,
+		runner: runner,
+	}
+}
+
+// eventually fails the test if the condition is not met soon
+func (p *testPools) eventually(what string, condition func() bool) {
+	p.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			p.t.Fatalf("timeout waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// info waits for the pool, settings are applied by the main loop asynchronously
+func (p *testPools) info(name string) PoolInfo {
+	p.t.Helper()
+	var found PoolInfo
+	p.eventually("pool "+name, func() bool {
+		for _, info := range p.GetInfo() {
+			if info.Settings.Name == name {
+				found = info
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// running returns not exited processes of the command
+func (p *testPools) running(cmd string) []*task.FakeProcess {
+	var running []*task.FakeProcess
+	for _, process := range p.runner.Running() {
+		if process.Spec.Args[0] == cmd {
+			running = append(running, process)
+		}
+	}
+	return running
+}
+
+// waitRunning waits for the number of running processes of the command
+func (p *testPools) waitRunning(cmd string, count int) []*task.FakeProcess {
+	p.t.Helper()
+	p.eventually("running "+cmd, func() bool {
+		return len(p.running(cmd)) == count && p.GetRunning() == int64(len(p.runner.Running()))
+	})
+	return p.running(cmd)
+}
+
+func (p *testPools) stop() {
+	p.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		p.t.Fatalf("pools are not stopped: %v", err)
+	}
+}
+
+// stopGroups stops the groups in background, the channel is closed when they are stopped
+func (p *testPools) stopGroups(groups ...string) chan bool {
+	done := make(chan bool)
+	go func() {
+		_ = p.StopGroups(context.Background(), groups)
+		close(done)
+	}()
+	return done
+}
+
+func isClosed(done chan bool) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// index returns the worker index of the process
+func index(process *task.FakeProcess) string {
+	return env(process, "JOBRO_WORKER_INDEX")
+}
+
+func env(process *task.FakeProcess, name string) string {
+	for _, kv := range process.Spec.Env {
+		if strings.HasPrefix(kv, name+"=") {
+			return strings.TrimPrefix(kv, name+"=")
+		}
+	}
+	return ""
+}
@@ -2,8 +2,13 @@ package instant
 
 import (
 	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/clock"
 	"github.com/stepan-s/jobro/log"
 	"github.com/stepan-s/jobro/pool/task"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,20 +19,64 @@ type PoolSettings struct {
 	Cmd   string `json:"cmd"`
 	Count int    `json:"count"`
 	Group string `json:"group"`
+	// Minimum running workers to be ready, group readiness rule is used if not set
+	MinReady    *int         `json:"min_ready"`
+	HealthCheck *HealthCheck `json:"health_check"`
+	// Stable name to roll out changes of the command and spawn settings
+	Name string `json:"name"`
+	// Drives the count by a metric, the count is the initial value
+	Autoscale *Autoscale `json:"autoscale"`
+	// Counts by schedule, the count is used until the first rule fires
+	Scale []ScaleRule `json:"scale"`
+	RecycleSettings
+	RolloutSettings
+	task.SpawnSettings
+}
+
+func (settings PoolSettings) GetName() string {
+	if settings.Name != "" {
+		return settings.Name
+	}
+	return settings.Cmd
 }
 
 type PoolStats struct {
-	Done    int64 `json:"done"`
-	Running int64 `json:"running"`
-	Failed  int64 `json:"failed"`
-	Errors  int64 `json:"errors"`
+	Done        int64 `json:"done"`
+	Running     int64 `json:"running"`
+	Failed      int64 `json:"failed"`
+	Errors      int64 `json:"errors"`
+	LimitKilled int64 `json:"limit_killed"`
+	// Workers restarted by failed health checks
+	Unhealthy int64 `json:"unhealthy"`
+	// Workers replaced by max lifetime, rss or cpu time
+	Recycled int64 `json:"recycled"`
+	task.ExitStats
+}
+
+func (stats *PoolStats) merge(other PoolStats) {
+	stats.Done += other.Done
+	stats.Running += other.Running
+	stats.Failed += other.Failed
+	stats.Errors += other.Errors
+	stats.LimitKilled += other.LimitKilled
+	stats.Unhealthy += other.Unhealthy
+	stats.Recycled += other.Recycled
+	stats.ExitStats.Merge(other.ExitStats)
 }
 
 type PoolInfo struct {
-	Id       uuid.UUID    `json:"id"`
-	Settings PoolSettings `json:"settings"`
-	Stats    PoolStats    `json:"stats"`
-	Pids     []int        `json:"pids"`
+	Id        uuid.UUID      `json:"id"`
+	Settings  PoolSettings   `json:"settings"`
+	Stats     PoolStats      `json:"stats"`
+	Pids      []int          `json:"pids"`
+	Workers   []WorkerHealth `json:"workers"`
+	Rollout   *RolloutInfo   `json:"rollout,omitempty"`
+	Autoscale *AutoscaleInfo `json:"autoscale,omitempty"`
+	Scale     *ScaleInfo     `json:"scale,omitempty"`
+	// Last exits of workers
+	Exits []WorkerExit `json:"exits"`
+	// The pool is removed or replaced and waits for its workers to stop
+	Stopping bool `json:"stopping"`
 }
 
 type PoolNotify struct {
@@ -40,8 +89,22 @@ type PoolStopCommand struct{}
 type PoolCountCommand struct {
 	count int
 }
+type PoolSettingsCommand struct {
+	settings PoolSettings
+	options  task.Options
+}
+type PoolRespawnCommand struct{}
+type PoolScaleCommand struct {
+	rule ScaleRule
+}
+type PoolOverrideCommand struct {
+	count int
+	ttl   time.Duration
+}
 
 type Pool struct {
+	id                uuid.UUID
+	name              string
 	Settings          PoolSettings
 	Stats             PoolStats
 	Workers           *task.Task
@@ -50,80 +113,327 @@ type Pool struct {
 	startChan         chan PoolStartCommand
 	stopChan          chan PoolStopCommand
 	setCountChan      chan PoolCountCommand
+	setSettingsChan   chan PoolSettingsCommand
+	healthChan        chan HealthResult
+	respawnChan       chan PoolRespawnCommand
+	slots             map[int]*slot
+	surge             map[int]*slot
+	generation        int
+	rollout           *RolloutInfo
+	rolloutHold       bool
+	rolloutFailures   int
+	infoMutex         sync.Mutex
+	rolloutInfo       *RolloutInfo
+	autoscaleChan     chan AutoscaleResult
+	autoscaleStop     chan bool
+	autoscaleInfo     AutoscaleInfo
+	autoscaleShared   *AutoscaleInfo
+	sharedSettings    PoolSettings
+	sharedStats       PoolStats
+	exits             []WorkerExit
+	location          *time.Location
+	baseCount         int
+	scaleChan         chan PoolScaleCommand
+	scaleCron         *clock.Cron
+	scaleRule         *ScaleRule
+	override          *Override
+	overrideChan      chan PoolOverrideCommand
+	overrideTimer     clock.Timer
+	scaleInfo         *ScaleInfo
+	crashes           crashes
+	health            health
+	clock             clock.Clock
+	runner            task.Runner
+	logger            *log.Logger
+	client            *http.Client
+	done              chan struct{}
+	stopping          int32
+}
+
+// Recent failures of workers
+type crashes struct {
+	mutex sync.Mutex
+	times []time.Time
+}
+
+// How many failures to keep
+const crashesLimit = 100
+
+func (c *crashes) add(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.times = append(c.times, t)
+	if len(c.times) > crashesLimit {
+		c.times = c.times[len(c.times)-crashesLimit:]
+	}
 }
 
-func NewPool(set PoolSettings, state chan PoolNotify) *Pool {
+func (c *crashes) count(window time.Duration, now time.Time) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	since := now.Add(-window)
+	count := 0
+	for _, t := range c.times {
+		if t.After(since) {
+			count += 1
+		}
+	}
+	return count
+}
+
+func NewPool(set PoolSettings, options task.Options, location *time.Location, client *http.Client, state chan PoolNotify) *Pool {
 	taskNotifications := make(chan task.Notify, 100)
-	worker := task.New(set.Cmd, taskNotifications)
+	if options.Clock == nil {
+		options.Clock = clock.Real
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if rule := activeRule(set.Scale, location, options.Clock.Now()); rule != nil {
+		set.Count = rule.Count
+	}
+	if set.Autoscale != nil {
+		set.Count = set.Autoscale.clamp(set.Count)
+	}
+	worker := task.New(set.Cmd, options, taskNotifications)
 	pool := &Pool{
+		id:                uuid.New(),
+		name:              set.Name,
 		Settings:          set,
-		Workers:           &worker,
+		sharedSettings:    set,
+		Workers:           worker,
+		clock:             options.Clock,
+		runner:            options.Runner,
+		logger:            options.Logger,
+		client:            client,
+		health:            health{clock: options.Clock, runner: options.Runner, client: client},
 		state:             state,
 		taskNotifications: taskNotifications,
 		startChan:         make(chan PoolStartCommand, 1),
 		stopChan:          make(chan PoolStopCommand, 1),
 		setCountChan:      make(chan PoolCountCommand, 100),
+		setSettingsChan:   make(chan PoolSettingsCommand, 100),
+		healthChan:        make(chan HealthResult, 100),
+		respawnChan:       make(chan PoolRespawnCommand, 100),
+		slots:             map[int]*slot{},
+		surge:             map[int]*slot{},
+		autoscaleChan:     make(chan AutoscaleResult, 1),
+		location:          location,
+		baseCount:         set.Count,
+		scaleChan:         make(chan PoolScaleCommand, 10),
+		overrideChan:      make(chan PoolOverrideCommand, 1),
+		done:              make(chan struct{}),
 	}
 
 	// main loop
 	go func() {
+		defer close(pool.done)
+		recycleTicker := pool.clock.NewTicker(recycleInterval)
+		defer recycleTicker.Stop()
+		pool.restartAutoscaler()
+		pool.startScaleRules()
+		pool.updateScaleInfo()
+		defer func() {
+			if pool.autoscaleStop != nil {
+				close(pool.autoscaleStop)
+			}
+			if pool.scaleCron != nil {
+				pool.scaleCron.Stop()
+			}
+			if pool.overrideTimer != nil {
+				pool.overrideTimer.Stop()
+			}
+		}()
 		exit := false
 	loop:
 		for {
 			select {
 			case event := <-pool.taskNotifications:
+				index, s, surge := pool.findSlot(event.Run)
 				switch event.Action {
 				case task.Start:
 					pool.Stats.Running += 1
+					if s != nil {
+						s.pid = event.Pid
+						s.started = pool.clock.Now()
+					}
+					pool.health.start(pool.Settings.HealthCheck, event.Pid, WorkerVars{Index: index, Count: pool.Settings.Count}, pool.healthChan)
+					if exit || index >= pool.Settings.Count {
+						pool.cancelPid(event.Pid)
+					} else if surge {
+						// The replacement is started, stop the old worker
+						old := pool.slots[index]
+						old.task.CancelPid(old.pid)
+					}
 				case task.Stop:
 					pool.Stats.Done += 1
 					pool.Stats.Running -= 1
+					pool.Stats.ExitStats.Add(event.Exit)
+					pool.addExit(index, event.Pid, event.Exit)
+					pool.health.stop(event.Pid)
+					if s != nil {
+						if surge {
+							delete(pool.surge, index)
+							pool.slots[index].recycling = false
+						} else if replacement, ok := pool.surge[index]; ok && s.recycling {
+							if !s.rollout {
+								pool.Stats.Recycled += 1
+							}
+							delete(pool.surge, index)
+							pool.slots[index] = replacement
+						} else {
+							delete(pool.slots, index)
+						}
+					}
 					if exit {
-						log.Info("Cron tasks in progress: %d", pool.Stats.Running)
-						if pool.Stats.Running == 0 {
-							log.Info("Instant pool stopped")
-							pool.state <- PoolNotify{PoolStop, pool}
+						pool.logger.Info("Cron tasks in progress: %d", pool.Stats.Running)
+						if pool.active() == 0 {
+							pool.notifyStopped()
 							break loop
 						}
 					} else {
-						if pool.Stats.Running < int64(pool.Settings.Count) {
-							go pool.Workers.Exec("instant")
-						}
+						pool.spawnMissing()
 					}
 				case task.FailStart:
 					pool.Stats.Failed += 1
-					go func() {
-						time.Sleep(time.Duration(5) * time.Second)
-						if pool.Stats.Running < int64(pool.Settings.Count) {
-							go pool.Workers.Exec("instant")
+					pool.crashes.add(pool.clock.Now())
+					if s != nil {
+						if surge {
+							delete(pool.surge, index)
+							pool.slots[index].recycling = false
+							// The next replacement waits for the respawn delay
+							pool.rolloutHold = true
+							pool.rolloutFailures += 1
+						} else {
+							delete(pool.slots, index)
+						}
+					}
+					if exit {
+						if pool.active() == 0 {
+							pool.notifyStopped()
+							break loop
 						}
-					}()
+					} else {
+						pool.clock.AfterFunc(time.Duration(5)*time.Second, func() {
+							select {
+							case pool.respawnChan <- PoolRespawnCommand{}:
+							case <-pool.done:
+							}
+						})
+					}
 				case task.Error:
+					// Recycled and replaced workers are not failed
+					if s != nil && (s.recycling || s.stopping) {
+						break
+					}
 					pool.Stats.Errors += 1
+					if !exit {
+						pool.crashes.add(pool.clock.Now())
+					}
+					if event.Reason != "" {
+						pool.Stats.LimitKilled += 1
+					}
 				}
-			case <-pool.startChan:
-				for i := pool.Stats.Running; i < int64(pool.Settings.Count); i += 1 {
-					go pool.Workers.Exec("instant")
+				if !exit {
+					pool.rolloutStep()
 				}
+			case <-pool.startChan:
+				pool.spawnMissing()
 				pool.state <- PoolNotify{PoolStart, pool}
+			case <-pool.respawnChan:
+				if !exit {
+					pool.rolloutHold = false
+					pool.spawnMissing()
+					pool.rolloutStep()
+				}
+			case scaleCommand := <-pool.scaleChan:
+				if exit {
+					break
+				}
+				if scaleCommand.rule.Cron != "" {
+					rule := scaleCommand.rule
+					pool.logger.Info("Instant pool %v scale rule %v, count %d", pool.Settings.Cmd, rule.Cron, rule.Count)
+					pool.scaleRule = &rule
+					pool.baseCount = rule.Count
+					if pool.Settings.Autoscale != nil {
+						pool.baseCount = pool.Settings.Autoscale.clamp(rule.Count)
+					}
+				}
+				pool.applyCount()
+			case overrideCommand := <-pool.overrideChan:
+				if !exit {
+					pool.setOverride(overrideCommand.count, overrideCommand.ttl)
+				}
+			case result := <-pool.autoscaleChan:
+				if !exit {
+					pool.autoscale(result)
+				}
+			case <-recycleTicker.C():
+				if !exit {
+					pool.recycle()
+				}
 			case setCountCommand := <-pool.setCountChan:
 				pool.setCount(setCountCommand.count)
+			case setSettingsCommand := <-pool.setSettingsChan:
+				if exit {
+					break
+				}
+				if pool.isSpawnChanged(setSettingsCommand.settings) {
+					pool.startRollout(setSettingsCommand.settings, setSettingsCommand.options)
+				}
+				pool.setSettings(setSettingsCommand.settings)
+				pool.rolloutStep()
+			case result := <-pool.healthChan:
+				if pool.Settings.HealthCheck == nil || exit {
+					break
+				}
+				if pool.health.update(result, pool.Settings.HealthCheck.getFailureThreshold()) {
+					pool.logger.Warning("Instant pool %v worker %d is unhealthy: %v, restart", pool.Settings.Cmd, result.pid, result.err)
+					pool.Stats.Unhealthy += 1
+					pool.cancelPid(result.pid)
+				}
 			case <-pool.stopChan:
-				log.Info("Instant pool stop tasks")
+				pool.logger.Info("Instant pool stop tasks")
 				exit = true
-				if pool.Stats.Running == 0 {
-					log.Info("Instant pool stopped")
-					pool.state <- PoolNotify{PoolStop, pool}
+				if pool.active() == 0 {
+					pool.notifyStopped()
 					break loop
 				} else {
-					pool.Workers.Cancel()
+					pool.cancelAll()
 				}
 			}
+			pool.publish()
 		}
 	}()
 	return pool
 }
 
+// publish shares settings and stats with other goroutines
+func (pool *Pool) publish() {
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	pool.sharedSettings = pool.Settings
+	pool.sharedStats = pool.Stats
+}
+
+func (pool *Pool) notifyStopped() {
+	pool.logger.Info("Instant pool stopped")
+	pool.publish()
+	pool.state <- PoolNotify{PoolStop, pool}
+}
+
+func (pool *Pool) getSettings() PoolSettings {
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	return pool.sharedSettings
+}
+
+func (pool *Pool) getStats() PoolStats {
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	return pool.sharedStats
+}
+
 func (pool *Pool) SetCount(count int) {
 	pool.setCountChan <- PoolCountCommand{
 		count: count,
@@ -132,13 +442,65 @@ func (pool *Pool) SetCount(count int) {
 
 func (pool *Pool) setCount(count int) {
 	pool.Settings.Count = count
-	running := pool.Workers.GetRunning()
-	if running < count {
-		for i := running; i < count; i += 1 {
-			go pool.Workers.Exec("instant")
+	pool.spawnMissing()
+	pool.stopExtra()
+}
+
+// SetSettings updates settings, workers are replaced gradually if the command or spawn settings are changed
+func (pool *Pool) SetSettings(settings PoolSettings, options task.Options) {
+	pool.setSettingsChan <- PoolSettingsCommand{
+		settings: settings,
+		options:  options,
+	}
+}
+
+func (pool *Pool) setSettings(settings PoolSettings) {
+	healthChanged := !reflect.DeepEqual(pool.Settings.HealthCheck, settings.HealthCheck)
+	autoscaleChanged := !reflect.DeepEqual(pool.Settings.Autoscale, settings.Autoscale)
+	rulesChanged := !reflect.DeepEqual(pool.Settings.Scale, settings.Scale)
+	pool.Settings.Group = settings.Group
+	pool.Settings.MinReady = settings.MinReady
+	pool.Settings.HealthCheck = settings.HealthCheck
+	pool.Settings.RecycleSettings = settings.RecycleSettings
+	pool.Settings.RolloutSettings = settings.RolloutSettings
+	pool.Settings.Scale = settings.Scale
+	if rulesChanged {
+		pool.startScaleRules()
+	}
+	switch {
+	case settings.Autoscale != nil && pool.Settings.Autoscale != nil:
+		// The count is driven by the autoscaler
+		pool.baseCount = settings.Autoscale.clamp(pool.baseCount)
+	case pool.scaleRule != nil:
+		pool.baseCount = pool.scaleRule.Count
+	default:
+		pool.baseCount = settings.Count
+	}
+	if settings.Autoscale != nil {
+		pool.baseCount = settings.Autoscale.clamp(pool.baseCount)
+	}
+	pool.Settings.Autoscale = settings.Autoscale
+	if autoscaleChanged {
+		pool.restartAutoscaler()
+	}
+	if healthChanged {
+		for _, workers := range []map[int]*slot{pool.slots, pool.surge} {
+			for index, s := range workers {
+				if s.pid != 0 {
+					pool.health.stop(s.pid)
+					pool.health.start(pool.Settings.HealthCheck, s.pid, WorkerVars{Index: index, Count: pool.Settings.Count}, pool.healthChan)
+				}
+			}
 		}
-	} else if running > count {
-		pool.Workers.CancelLimited(running - count)
+	}
+	pool.applyCount()
+}
+
+// Override sets the count for the ttl, zero ttl resets the override
+func (pool *Pool) Override(count int, ttl time.Duration) {
+	select {
+	case pool.overrideChan <- PoolOverrideCommand{count: count, ttl: ttl}:
+	case <-pool.done:
 	}
 }
 
@@ -147,30 +509,41 @@ func (pool *Pool) Start() {
 }
 
 func (pool *Pool) Stop() {
+	atomic.StoreInt32(&pool.stopping, 1)
 	pool.stopChan <- PoolStopCommand{}
 }
 
 func (pool *Pool) GetDone() int64 {
-	return pool.Stats.Done
+	return pool.getStats().Done
 }
 
 func (pool *Pool) GetRunning() int64 {
-	return pool.Stats.Running
+	return pool.getStats().Running
 }
 
 func (pool *Pool) GetFailed() int64 {
-	return pool.Stats.Failed
+	return pool.getStats().Failed
 }
 
 func (pool *Pool) GetErrors() int64 {
-	return pool.Stats.Errors
+	return pool.getStats().Errors
+}
+
+func (pool *Pool) GetLimitKilled() int64 {
+	return pool.getStats().LimitKilled
 }
 
 func (pool *Pool) getInfo() PoolInfo {
 	return PoolInfo{
-		Id:       pool.Workers.GetId(),
-		Settings: pool.Settings,
-		Stats:    pool.Stats,
-		Pids:     pool.Workers.GetPids(),
+		Id:        pool.id,
+		Settings:  pool.getSettings(),
+		Stats:     pool.getStats(),
+		Pids:      pool.health.pids(),
+		Workers:   pool.health.list(),
+		Rollout:   pool.getRollout(),
+		Autoscale: pool.getAutoscale(),
+		Scale:     pool.getScale(),
+		Exits:     pool.getExits(),
+		Stopping:  atomic.LoadInt32(&pool.stopping) == 1,
 	}
 }
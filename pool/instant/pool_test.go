@@ -0,0 +1,237 @@
+package instant
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRespawnWorkerOfSlot(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 2}}, nil)
+	workers := p.waitRunning("a", 2)
+	for _, process := range workers {
+		if env(process, "JOBRO_WORKER_COUNT") != "2" {
+			t.Errorf("worker env %v, want the count 2", process.Spec.Env)
+		}
+	}
+
+	failed := workers[0]
+	_ = failed.Exit(1)
+	respawned := p.waitRunning("a", 2)
+	if len(p.runner.Processes()) != 3 {
+		t.Fatalf("processes %d, want 3", len(p.runner.Processes()))
+	}
+	indexes := map[string]bool{index(respawned[0]): true, index(respawned[1]): true}
+	if !indexes["0"] || !indexes["1"] {
+		t.Errorf("worker indexes %v, want 0 and 1", indexes)
+	}
+
+	p.eventually("stats", func() bool {
+		stats := p.info("a").Stats
+		return stats.Done == 1 && stats.Errors == 1
+	})
+	exits := p.info("a").Exits
+	if len(exits) != 1 || exits[0].Pid != failed.Pid() || exits[0].Exit.Code != 1 {
+		t.Errorf("exits %+v, want the failed worker", exits)
+	}
+	p.stop()
+}
+
+func TestFailStartRespawnsAfterDelay(t *testing.T) {
+	p := newTestPools(t)
+	p.runner.SetSpawnError(errors.New("no such file"))
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 1}}, nil)
+	p.eventually("fail start", func() bool {
+		return p.info("a").Stats.Failed == 1
+	})
+	// The recycle ticker and the respawn timer
+	p.eventually("respawn timer", func() bool {
+		return p.clock.Timers() == 2
+	})
+
+	p.runner.SetSpawnError(nil)
+	p.clock.Advance(4 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if len(p.runner.Processes()) != 0 {
+		t.Fatalf("respawned before the delay")
+	}
+	p.clock.Advance(time.Second)
+	p.waitRunning("a", 1)
+	p.stop()
+}
+
+func TestReloadKeepsPoolByName(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 1}}, nil)
+	first := p.waitRunning("a", 1)[0]
+	id := p.info("a").Id
+
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 3}}, nil)
+	p.waitRunning("a", 3)
+	if info := p.info("a"); info.Id != id {
+		t.Errorf("pool id %v, want %v", info.Id, id)
+	}
+	if first.Exited() {
+		t.Errorf("running worker is restarted on reload")
+	}
+
+	p.SetTasks(nil, nil)
+	p.waitRunning("a", 0)
+	p.eventually("pool removal", func() bool {
+		return len(p.GetInfo()) == 0
+	})
+	p.stop()
+}
+
+func TestScaleDownStopsHighestIndexes(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 3}}, nil)
+	workers := p.waitRunning("a", 3)
+
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 1}}, nil)
+	left := p.waitRunning("a", 1)
+	if index(left[0]) != "0" {
+		t.Errorf("worker %v is left, want 0", index(left[0]))
+	}
+	for _, process := range workers {
+		if process == left[0] {
+			continue
+		}
+		if signals := process.Signals(); len(signals) != 1 || signals[0] != syscall.SIGINT {
+			t.Errorf("worker %v signals %v, want SIGINT", index(process), signals)
+		}
+	}
+	if len(p.runner.Processes()) != 3 {
+		t.Errorf("stopped workers are respawned")
+	}
+	p.stop()
+}
+
+func TestCmdChangeRollsOut(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 2}}, nil)
+	old := p.waitRunning("a", 2)
+	id := p.info("a").Id
+
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "b", Count: 2}}, nil)
+	p.waitRunning("a", 0)
+	p.waitRunning("b", 2)
+	p.eventually("rollout", func() bool {
+		rollout := p.info("a").Rollout
+		return rollout != nil && rollout.Status == RolloutDone
+	})
+	info := p.info("a")
+	if info.Id != id || info.Rollout.Updated != 2 {
+		t.Errorf("pool %v rollout %+v, want the same pool with 2 updated", info.Id, info.Rollout)
+	}
+	for _, process := range old {
+		if len(process.Signals()) != 1 {
+			t.Errorf("old worker signals %v, want one stop signal", process.Signals())
+		}
+	}
+	if info.Stats.Errors != 0 {
+		t.Errorf("replaced workers are counted as errors")
+	}
+	p.stop()
+}
+
+func TestRolloutFailStartWaitsRespawnDelay(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 1}}, nil)
+	old := p.waitRunning("a", 1)[0]
+
+	p.runner.SetSpawnError(errors.New("no such file"))
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "b", Count: 1}}, nil)
+	p.eventually("fail start", func() bool {
+		rollout := p.info("a").Rollout
+		return rollout != nil && rollout.StartFailures == 1
+	})
+	time.Sleep(10 * time.Millisecond)
+	if info := p.info("a"); info.Stats.Failed != 1 || info.Rollout.Status != RolloutInProgress {
+		t.Fatalf("stats %+v rollout %+v, want one failed start before the delay", info.Stats, info.Rollout)
+	}
+	if old.Exited() {
+		t.Fatalf("old worker is stopped without a replacement")
+	}
+
+	p.runner.SetSpawnError(nil)
+	p.clock.Advance(5 * time.Second)
+	p.waitRunning("b", 1)
+	p.eventually("rollout", func() bool {
+		return p.info("a").Rollout.Status == RolloutDone
+	})
+	p.stop()
+}
+
+func TestStopGroupsStopsOnlyGroups(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{
+		{Name: "web", Cmd: "web", Count: 2, Group: "web"},
+		{Name: "db", Cmd: "db", Count: 1, Group: "db"},
+	}, nil)
+	web := p.waitRunning("web", 2)
+	db := p.waitRunning("db", 1)[0]
+
+	done := p.stopGroups("web")
+	p.waitRunning("web", 0)
+	p.eventually("groups stop", func() bool {
+		return isClosed(done)
+	})
+	for _, process := range web {
+		if !process.Exited() {
+			t.Errorf("web worker is not stopped")
+		}
+	}
+	if db.Exited() {
+		t.Errorf("db worker is stopped with the web group")
+	}
+
+	// Pools are not updated while stopping
+	p.SetTasks([]PoolSettings{{Name: "web", Cmd: "web", Count: 2, Group: "web"}}, nil)
+	time.Sleep(10 * time.Millisecond)
+	if len(p.running("web")) != 0 {
+		t.Errorf("web pool is started while stopping")
+	}
+	p.stop()
+	if !db.Exited() {
+		t.Errorf("db worker is not stopped")
+	}
+}
+
+func TestStopContextDone(t *testing.T) {
+	p := newTestPools(t)
+	p.runner.Ignore[syscall.SIGINT] = true
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 1}}, nil)
+	worker := p.waitRunning("a", 1)[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("stop error %v, want deadline exceeded", err)
+	}
+	select {
+	case <-p.Done():
+		t.Fatalf("pools are done with a running worker")
+	default:
+	}
+
+	// The killed worker is not respawned
+	_ = worker.Signal(syscall.SIGKILL)
+	p.eventually("done", func() bool {
+		select {
+		case <-p.Done():
+			return true
+		default:
+			return false
+		}
+	})
+	if len(p.runner.Processes()) != 1 {
+		t.Errorf("worker is respawned while stopping")
+	}
+	if p.GetInfo() != nil || p.Override("a", 1, time.Hour) {
+		t.Errorf("stopped pools return the state")
+	}
+}
@@ -1,42 +1,112 @@
 package instant
 
 import (
+	"context"
+	"github.com/stepan-s/jobro/clock"
 	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/group"
+	"github.com/stepan-s/jobro/pool/task"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
 )
 
 type SetTasksCommand struct {
 	settings []PoolSettings
+	groups   map[string]group.Settings
 }
 
-type PoolsStopCommand struct {
-	onstop func()
+type PoolsStopCommand struct{}
+
+type PoolsStopGroupsCommand struct {
+	groups   []string
+	response chan bool
 }
 
 type PoolsGetInfoCommand struct {
 	response chan []PoolInfo
 }
 
+type PoolsGetReadinessCommand struct {
+	response chan []PoolReadiness
+}
+
+type PoolsPingCommand struct {
+	response chan bool
+}
+
+type PoolsOverrideCommand struct {
+	ref      string
+	count    int
+	ttl      time.Duration
+	response chan bool
+}
+
+type Options struct {
+	// Default timezone of scale rules
+	Location *time.Location
+	// Spawns workers, task.ExecRunner by default
+	Runner task.Runner
+	// Processes of the workers, the shared registry by default
+	Registry *task.Registry
+	// Time source of timers, tickers and scale rules, the real clock by default
+	Clock clock.Clock
+	// Client of http health checks and autoscale metrics, http.DefaultClient by default
+	HttpClient *http.Client
+	// Log of the pools and their workers, the global log if nil
+	Logger *log.Logger
+}
+
 type Pools struct {
-	items             []*Pool
+	options Options
+	items   []*Pool
+	// Counters of removed pools, so totals do not go down
+	removed PoolStats
+	// Guards items and removed for readers out of the main loop, they are changed by the main loop only
+	itemsMutex        sync.Mutex
+	groups            map[string]group.Settings
 	running           int
 	setTasksChan      chan SetTasksCommand
 	stopChan          chan PoolsStopCommand
+	stopGroupsChan    chan PoolsStopGroupsCommand
 	getInfoChan       chan PoolsGetInfoCommand
+	getReadinessChan  chan PoolsGetReadinessCommand
+	pingChan          chan PoolsPingCommand
+	overrideChan      chan PoolsOverrideCommand
 	poolNotifications chan PoolNotify
+	done              chan struct{}
 }
 
-func New() *Pools {
+func New(options Options) *Pools {
+	if options.Location == nil {
+		options.Location = time.Local
+	}
+	if options.Clock == nil {
+		options.Clock = clock.Real
+	}
 	pools := &Pools{
+		options:           options,
+		overrideChan:      make(chan PoolsOverrideCommand, 1),
 		setTasksChan:      make(chan SetTasksCommand, 1),
 		stopChan:          make(chan PoolsStopCommand, 1),
+		stopGroupsChan:    make(chan PoolsStopGroupsCommand, 1),
 		getInfoChan:       make(chan PoolsGetInfoCommand, 1),
+		getReadinessChan:  make(chan PoolsGetReadinessCommand, 1),
+		pingChan:          make(chan PoolsPingCommand, 1),
+		groups:            map[string]group.Settings{},
 		poolNotifications: make(chan PoolNotify, 100),
+		done:              make(chan struct{}),
 	}
 
 	// main loop
 	go func() {
+		defer close(pools.done)
 		exit := false
-		var onstop func() = nil
+		// Pools stopping by groups
+		stopping := false
+		waiting := map[*Pool]bool{}
+		var groupsStopped chan bool
 	loop:
 		for {
 			select {
@@ -47,125 +117,246 @@ func New() *Pools {
 				case PoolStop:
 					pools.running -= 1
 					pools.remove(event.Pool)
+					if waiting[event.Pool] {
+						delete(waiting, event.Pool)
+						if len(waiting) == 0 && groupsStopped != nil {
+							groupsStopped <- true
+							groupsStopped = nil
+						}
+					}
 					if exit {
-						log.Info("Instant pools active: %d", pools.running)
+						pools.options.Logger.Info("Instant pools active: %d", pools.running)
 						if pools.running == 0 {
-							log.Info("Instant pools stopped")
-							if onstop != nil {
-								onstop()
-							}
+							pools.options.Logger.Info("Instant pools stopped")
 							break loop
 						}
 					}
 				}
 			case setTasksCommand := <-pools.setTasksChan:
+				if stopping {
+					pools.options.Logger.Info("Instant pools are stopping, pools are not updated")
+					break
+				}
+				pools.groups = setTasksCommand.groups
 				pools.setTasks(setTasksCommand.settings)
+			case stopGroupsCommand := <-pools.stopGroupsChan:
+				stopping = true
+				for _, pool := range pools.items {
+					settings := pool.getSettings()
+					if inGroups(settings.Group, stopGroupsCommand.groups) {
+						waiting[pool] = true
+						pool.Stop()
+						pools.options.Logger.Info("Stop instant pool %v of group '%v'", settings.Cmd, settings.Group)
+					}
+				}
+				if len(waiting) == 0 {
+					stopGroupsCommand.response <- true
+				} else {
+					groupsStopped = stopGroupsCommand.response
+				}
 			case getInfoCommand := <-pools.getInfoChan:
 				getInfoCommand.response <- pools.getInfo()
-			case stopCommand := <-pools.stopChan:
-				log.Info("Instant pools stop")
-				exit = true
+			case getReadinessCommand := <-pools.getReadinessChan:
+				getReadinessCommand.response <- pools.getReadiness()
+			case overrideCommand := <-pools.overrideChan:
+				pool := pools.findByRef(overrideCommand.ref)
+				if pool != nil && !stopping {
+					pool.Override(overrideCommand.count, overrideCommand.ttl)
+				}
+				overrideCommand.response <- pool != nil && !stopping
+			case pingCommand := <-pools.pingChan:
+				pingCommand.response <- true
+			case <-pools.stopChan:
+				pools.options.Logger.Info("Instant pools stop")
 				if pools.running == 0 {
-					log.Info("Instant pools stopped")
-					if stopCommand.onstop != nil {
-						stopCommand.onstop()
-					}
+					pools.options.Logger.Info("Instant pools stopped")
 					break loop
-				} else {
-					onstop = stopCommand.onstop
+				}
+				if !exit {
 					for _, pool := range pools.items {
 						pool.Stop()
 					}
 				}
+				exit = true
+				stopping = true
 			}
 		}
 	}()
 	return pools
 }
 
-func (pools *Pools) SetTasks(settings []PoolSettings) {
-	pools.setTasksChan <- SetTasksCommand{settings: settings}
+func (pools *Pools) SetTasks(settings []PoolSettings, groups map[string]group.Settings) {
+	if groups == nil {
+		groups = map[string]group.Settings{}
+	}
+	select {
+	case pools.setTasksChan <- SetTasksCommand{settings: settings, groups: groups}:
+	case <-pools.done:
+	}
+}
+
+// Stop stops all pools, it returns the context error if workers are not finished when the context is done
+func (pools *Pools) Stop(ctx context.Context) error {
+	select {
+	case pools.stopChan <- PoolsStopCommand{}:
+	case <-pools.done:
+		return nil
+	}
+	select {
+	case <-pools.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (pools *Pools) Stop(onstop func()) {
-	pools.stopChan <- PoolsStopCommand{onstop: onstop}
+// Done is closed when all pools are stopped, getters return empty values then
+func (pools *Pools) Done() <-chan struct{} {
+	return pools.done
+}
+
+// StopGroups stops pools of the groups and waits for them, other pools are not updated after it
+func (pools *Pools) StopGroups(ctx context.Context, groups []string) error {
+	response := make(chan bool, 1)
+	select {
+	case pools.stopGroupsChan <- PoolsStopGroupsCommand{groups: groups, response: response}:
+	case <-pools.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-response:
+	case <-pools.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func inGroups(group string, groups []string) bool {
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
 }
 
 func (pools *Pools) setTasks(settings []PoolSettings) {
 	var newPools []*Pool
 	for _, set := range settings {
-		pool := findPoolByCmd(pools.items, set.Cmd)
+		options, err := set.SpawnSettings.Options()
+		if err != nil {
+			pools.options.Logger.Error("Fail prepare instant pool %v, error: %v", set.Cmd, err)
+			continue
+		}
+		options.Runner = pools.options.Runner
+		options.Registry = pools.options.Registry
+		options.Clock = pools.options.Clock
+		options.Logger = pools.options.Logger
+		pool := findPool(pools.items, set)
 		if pool != nil {
 			newPools = append(newPools, pool)
-			pool.SetCount(set.Count)
-			log.Info("Set count %d for instant pool %v", set.Count, set.Cmd)
+			pool.SetSettings(set, options)
+			pools.options.Logger.Info("Set count %d for instant pool %v", set.Count, set.Cmd)
 		} else {
-			pool = NewPool(set, pools.poolNotifications)
+			pool = NewPool(set, options, pools.options.Location, pools.options.HttpClient, pools.poolNotifications)
 			newPools = append(newPools, pool)
-			log.Info("Add instant pool %v count %d", set.Cmd, set.Count)
+			pools.options.Logger.Info("Add instant pool %v count %d", set.Cmd, set.Count)
 			pool.Start()
 		}
 	}
 	for _, pool := range pools.items {
-		exist := findPoolByCmd(newPools, pool.Settings.Cmd)
+		exist := findPoolOf(newPools, pool)
 		if exist == nil {
 			newPools = append(newPools, pool)
 			pool.Stop()
-			log.Info("Stop instant pool %v", pool.Settings.Cmd)
+			pools.options.Logger.Info("Stop instant pool %v", pool.getSettings().Cmd)
 		}
 	}
-	pools.items = newPools
+	pools.setItems(newPools)
 }
 
 func (pools *Pools) remove(pool *Pool) {
 	var newPools []*Pool
 	for _, p := range pools.items {
-		if p.Settings.Cmd != pool.Settings.Cmd {
+		if p != pool {
 			newPools = append(newPools, p)
 		}
 	}
+	stats := pool.getStats()
+	pools.itemsMutex.Lock()
+	defer pools.itemsMutex.Unlock()
 	pools.items = newPools
+	pools.removed.merge(stats)
+}
+
+func (pools *Pools) setItems(items []*Pool) {
+	pools.itemsMutex.Lock()
+	defer pools.itemsMutex.Unlock()
+	pools.items = items
+}
+
+// totals sums stats of the pools and removed pools for readers out of the main loop
+func (pools *Pools) totals() PoolStats {
+	pools.itemsMutex.Lock()
+	defer pools.itemsMutex.Unlock()
+	total := pools.removed
+	for _, pool := range pools.items {
+		total.merge(pool.getStats())
+	}
+	return total
 }
 
-func findPoolByCmd(list []*Pool, cmd string) *Pool {
+// findPool finds the pool by name, or by command and spawn settings if the name is not set
+func findPool(list []*Pool, set PoolSettings) *Pool {
 	for _, pool := range list {
-		if pool.Settings.Cmd == cmd {
+		if set.Name != "" || pool.name != "" {
+			if pool.name == set.Name {
+				return pool
+			}
+			continue
+		}
+		settings := pool.getSettings()
+		if settings.Cmd == set.Cmd && reflect.DeepEqual(settings.SpawnSettings, set.SpawnSettings) {
 			return pool
 		}
 	}
 	return nil
 }
 
-func (pools *Pools) GetDone() int64 {
-	var total int64
-	for _, pool := range pools.items {
-		total += pool.Stats.Done
+func findPoolOf(list []*Pool, pool *Pool) *Pool {
+	for _, p := range list {
+		if p == pool {
+			return p
+		}
 	}
-	return total
+	return nil
+}
+
+func (pools *Pools) GetDone() int64 {
+	return pools.totals().Done
 }
 
 func (pools *Pools) GetRunning() int64 {
-	var total int64
-	for _, pool := range pools.items {
-		total += pool.Stats.Running
-	}
-	return total
+	return pools.totals().Running
 }
 
 func (pools *Pools) GetFailed() int64 {
-	var total int64
-	for _, pool := range pools.items {
-		total += pool.Stats.Failed
-	}
-	return total
+	return pools.totals().Failed
 }
 
 func (pools *Pools) GetErrors() int64 {
-	var total int64
-	for _, pool := range pools.items {
-		total += pool.Stats.Errors
-	}
-	return total
+	return pools.totals().Errors
+}
+
+func (pools *Pools) GetLimitKilled() int64 {
+	return pools.totals().LimitKilled
+}
+
+func (pools *Pools) GetExitStats() task.ExitStats {
+	return pools.totals().ExitStats
 }
 
 func (pools *Pools) getInfo() []PoolInfo {
@@ -178,8 +369,73 @@ func (pools *Pools) getInfo() []PoolInfo {
 
 func (pools *Pools) GetInfo() []PoolInfo {
 	response := make(chan []PoolInfo, 1)
-	pools.getInfoChan <- PoolsGetInfoCommand{
-		response: response,
+	select {
+	case pools.getInfoChan <- PoolsGetInfoCommand{response: response}:
+	case <-pools.done:
+		return nil
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-pools.done:
+		return nil
+	}
+}
+
+func (pools *Pools) GetReadiness() []PoolReadiness {
+	response := make(chan []PoolReadiness, 1)
+	select {
+	case pools.getReadinessChan <- PoolsGetReadinessCommand{response: response}:
+	case <-pools.done:
+		return nil
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-pools.done:
+		return nil
+	}
+}
+
+// Ping returns whether the main loop responds within the timeout
+func (pools *Pools) Ping(timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	response := make(chan bool, 1)
+	select {
+	case pools.pingChan <- PoolsPingCommand{response: response}:
+	case <-deadline:
+		return false
+	}
+	select {
+	case <-response:
+		return true
+	case <-deadline:
+		return false
+	}
+}
+
+// findByRef finds the pool by id or name
+func (pools *Pools) findByRef(ref string) *Pool {
+	for _, pool := range pools.items {
+		if pool.id.String() == ref || (pool.name != "" && pool.name == ref) {
+			return pool
+		}
+	}
+	return nil
+}
+
+// Override sets the count of the pool for the ttl, zero ttl resets the override, returns false if the pool is not found
+func (pools *Pools) Override(ref string, count int, ttl time.Duration) bool {
+	response := make(chan bool, 1)
+	select {
+	case pools.overrideChan <- PoolsOverrideCommand{ref: ref, count: count, ttl: ttl, response: response}:
+	case <-pools.done:
+		return false
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-pools.done:
+		return false
 	}
-	return <-response
 }
@@ -0,0 +1,111 @@
+package instant
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitRunning(t *testing.T, pools *Pools, count int64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for pools.GetRunning() != count && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if running := pools.GetRunning(); running != count {
+		t.Fatalf("running %d, want %d", running, count)
+	}
+}
+
+// scrape reads pools stats like metrics and api do until stop is closed
+func scrape(pools *Pools, stop chan bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+			_ = pools.GetDone()
+			_ = pools.GetRunning()
+			_ = pools.GetFailed()
+			_ = pools.GetErrors()
+			_ = pools.GetLimitKilled()
+			_ = pools.GetExitStats()
+		}
+	}
+}
+
+func TestConcurrentSpawnStopAndScrape(t *testing.T) {
+	pools := New(Options{})
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i += 1 {
+		wg.Add(1)
+		go scrape(pools, stop, &wg)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = pools.GetInfo()
+				_ = pools.GetReadiness()
+			}
+		}
+	}()
+
+	pools.SetTasks([]PoolSettings{
+		{Name: "a", Cmd: "sleep 10", Count: 3},
+		{Name: "b", Cmd: "sleep 10", Count: 2},
+	}, nil)
+	waitRunning(t, pools, 5)
+
+	// Scale one pool and remove another
+	pools.SetTasks([]PoolSettings{
+		{Name: "a", Cmd: "sleep 10", Count: 6},
+	}, nil)
+	waitRunning(t, pools, 6)
+
+	for _, info := range pools.GetInfo() {
+		if info.Settings.Name == "a" && len(info.Pids) != 6 {
+			t.Errorf("pool a pids %v, want 6", info.Pids)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// Scrape while stopping
+	stop = make(chan bool)
+	wg.Add(1)
+	go scrape(pools, stop, &wg)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pools.Stop(ctx); err != nil {
+		t.Fatalf("pools are not stopped: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestTotalsKeepRemovedPools(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 1}, {Name: "b", Cmd: "b", Count: 1}}, nil)
+	p.waitRunning("a", 1)[0].Exit(1)
+	p.waitRunning("b", 1)
+	p.eventually("error", func() bool {
+		return p.GetErrors() == 1 && len(p.running("a")) == 1
+	})
+
+	// The removed worker exits by the stop signal, it is counted as an error too
+	p.SetTasks([]PoolSettings{{Name: "b", Cmd: "b", Count: 1}}, nil)
+	p.eventually("removed pool", func() bool {
+		return len(p.GetInfo()) == 1
+	})
+	if done, errors, signaled := p.GetDone(), p.GetErrors(), p.GetExitStats().Signaled; done != 2 || errors != 2 || signaled != 1 {
+		t.Errorf("done %d, errors %d, signaled %d after the pool is removed, want 2, 2, 1", done, errors, signaled)
+	}
+	p.stop()
+}
@@ -0,0 +1,58 @@
+package instant
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/pool/group"
+)
+
+type PoolReadiness struct {
+	Id            uuid.UUID `json:"id"`
+	Cmd           string    `json:"cmd"`
+	Group         string    `json:"group"`
+	Ready         bool      `json:"ready"`
+	Ignored       bool      `json:"ignored,omitempty"`
+	Running       int64     `json:"running"`
+	MinReady      int       `json:"min_ready"`
+	RecentCrashes int       `json:"recent_crashes"`
+	CrashLoop     bool      `json:"crash_loop"`
+	Reason        string    `json:"reason,omitempty"`
+}
+
+func (pool *Pool) readiness(rules group.Readiness) PoolReadiness {
+	settings := pool.getSettings()
+	minReady := rules.MinReady
+	if settings.MinReady != nil {
+		minReady = *settings.MinReady
+	}
+	if minReady > settings.Count {
+		minReady = settings.Count
+	}
+	info := PoolReadiness{
+		Id:            pool.id,
+		Cmd:           settings.Cmd,
+		Group:         settings.Group,
+		Ready:         true,
+		Ignored:       rules.Ignore,
+		Running:       pool.getStats().Running,
+		MinReady:      minReady,
+		RecentCrashes: pool.crashes.count(rules.GetCrashLoopWindow(), pool.clock.Now()),
+	}
+	info.CrashLoop = info.RecentCrashes >= rules.GetCrashLoopRestarts()
+	if info.CrashLoop {
+		info.Ready = false
+		info.Reason = fmt.Sprintf("%d failures in %v", info.RecentCrashes, rules.GetCrashLoopWindow())
+	} else if info.Running < int64(minReady) {
+		info.Ready = false
+		info.Reason = fmt.Sprintf("%d of %d workers running", info.Running, minReady)
+	}
+	return info
+}
+
+func (pools *Pools) getReadiness() []PoolReadiness {
+	var list []PoolReadiness
+	for _, pool := range pools.items {
+		list = append(list, pool.readiness(pools.groups[pool.getSettings().Group].Readiness))
+	}
+	return list
+}
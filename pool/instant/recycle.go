@@ -0,0 +1,90 @@
+package instant
+
+import (
+	"github.com/stepan-s/jobro/pool/task"
+	"sort"
+	"time"
+)
+
+// How often to check workers for recycling
+const recycleInterval = 5 * time.Second
+
+const RecycleLifetime = "max_lifetime"
+const RecycleRss = "max_rss"
+const RecycleCpuTime = "max_cpu_time"
+
+// Thresholds to replace a worker, 0 - no limit
+type RecycleSettings struct {
+	MaxLifetime task.Duration `json:"max_lifetime"`
+	// Bytes, K, M and G suffixes are allowed
+	MaxRss     string        `json:"max_rss"`
+	MaxCpuTime task.Duration `json:"max_cpu_time"`
+}
+
+func (settings RecycleSettings) isEmpty() bool {
+	return settings.MaxLifetime <= 0 && settings.MaxRss == "" && settings.MaxCpuTime <= 0
+}
+
+func (settings RecycleSettings) Validate() error {
+	if settings.MaxRss != "" {
+		if _, err := task.ParseBytes(settings.MaxRss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reason returns the crossed threshold of the worker
+func (settings RecycleSettings) reason(s *slot, now time.Time) string {
+	if settings.MaxLifetime > 0 && now.Sub(s.started) >= settings.MaxLifetime.Duration() {
+		return RecycleLifetime
+	}
+	if settings.MaxRss != "" {
+		limit, _ := task.ParseBytes(settings.MaxRss)
+		rss, err := task.ProcessRss(s.pid)
+		if err == nil && rss >= limit {
+			return RecycleRss
+		}
+	}
+	if settings.MaxCpuTime > 0 {
+		cpu, err := task.ProcessCpuTime(s.pid)
+		if err == nil && cpu >= settings.MaxCpuTime.Duration() {
+			return RecycleCpuTime
+		}
+	}
+	return ""
+}
+
+// recycle starts replacements of workers crossed thresholds, old workers are stopped when replacements start.
+// Replacements in progress are limited by max_surge of the rollout settings, at least one.
+func (pool *Pool) recycle() {
+	if pool.Settings.RecycleSettings.isEmpty() {
+		return
+	}
+	maxSurge, _ := pool.Settings.RolloutSettings.limits()
+	if maxSurge < 1 {
+		maxSurge = 1
+	}
+	var indexes []int
+	for index := range pool.slots {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	now := pool.clock.Now()
+	for _, index := range indexes {
+		if len(pool.surge) >= maxSurge {
+			return
+		}
+		s := pool.slots[index]
+		if s.pid == 0 || s.recycling || index >= pool.Settings.Count {
+			continue
+		}
+		reason := pool.Settings.RecycleSettings.reason(s, now)
+		if reason == "" {
+			continue
+		}
+		pool.logger.Info("Instant pool %v recycle worker %d of slot %d: %v", pool.Settings.Cmd, s.pid, index, reason)
+		s.recycling = true
+		pool.surge[index] = pool.exec(index)
+	}
+}
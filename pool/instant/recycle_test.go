@@ -0,0 +1,92 @@
+package instant
+
+import (
+	"context"
+	"github.com/stepan-s/jobro/pool/task"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRecycleByLifetime(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{
+		Name:            "a",
+		Cmd:             "a",
+		Count:           1,
+		RecycleSettings: RecycleSettings{MaxLifetime: task.Duration(time.Minute)},
+	}}, nil)
+	old := p.waitRunning("a", 1)[0]
+
+	p.clock.Advance(55 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if old.Exited() || len(p.runner.Processes()) != 1 {
+		t.Fatalf("worker is recycled before the lifetime")
+	}
+
+	p.clock.Advance(5 * time.Second)
+	p.eventually("recycle", func() bool {
+		return old.Exited() && p.info("a").Stats.Recycled == 1
+	})
+	replacement := p.waitRunning("a", 1)[0]
+	if replacement == old || index(replacement) != index(old) {
+		t.Errorf("replacement index %v, want a new worker of slot %v", index(replacement), index(old))
+	}
+	if info := p.info("a"); info.Stats.Errors != 0 {
+		t.Errorf("recycled worker is counted as error: %+v", info.Stats)
+	}
+	p.stop()
+}
+
+func TestRecycleLimitsSurge(t *testing.T) {
+	p := newTestPools(t)
+	p.runner.Ignore[syscall.SIGINT] = true
+	p.SetTasks([]PoolSettings{{
+		Name:            "a",
+		Cmd:             "a",
+		Count:           3,
+		RecycleSettings: RecycleSettings{MaxLifetime: task.Duration(time.Minute)},
+	}}, nil)
+	old := p.waitRunning("a", 3)
+
+	p.clock.Advance(time.Minute)
+	p.eventually("replacement", func() bool {
+		return len(p.runner.Processes()) == 4
+	})
+	p.clock.Advance(recycleInterval)
+	time.Sleep(10 * time.Millisecond)
+	if n := len(p.runner.Processes()); n != 4 {
+		t.Fatalf("%d processes, want one replacement at a time", n)
+	}
+
+	// The next worker is recycled after the previous one is replaced
+	for i := 0; i < len(old); i += 1 {
+		var stopping *task.FakeProcess
+		p.eventually("stop signal", func() bool {
+			for _, process := range old {
+				if !process.Exited() && len(process.Signals()) > 0 {
+					stopping = process
+					return true
+				}
+			}
+			return false
+		})
+		stopping.Exit(0)
+		recycled := int64(i + 1)
+		p.eventually("recycled", func() bool {
+			return p.info("a").Stats.Recycled == recycled
+		})
+		p.clock.Advance(recycleInterval)
+	}
+	if n := len(p.runner.Processes()); n != 6 {
+		t.Errorf("%d processes, want 3 workers and 3 replacements", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_ = p.Stop(ctx)
+	for _, process := range p.running("a") {
+		_ = process.Signal(syscall.SIGKILL)
+	}
+	<-p.Done()
+}
@@ -0,0 +1,144 @@
+package instant
+
+import (
+	"github.com/stepan-s/jobro/pool/task"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const RolloutInProgress = "in_progress"
+const RolloutDone = "done"
+
+// Limits of a rolling replacement of workers
+type RolloutSettings struct {
+	// Workers to start over the count, 1 by default
+	MaxSurge *int `json:"max_surge"`
+	// Workers to stop before replacements are started
+	MaxUnavailable int `json:"max_unavailable"`
+}
+
+func (settings RolloutSettings) limits() (int, int) {
+	surge := 1
+	if settings.MaxSurge != nil {
+		surge = *settings.MaxSurge
+	}
+	unavailable := settings.MaxUnavailable
+	if surge <= 0 && unavailable <= 0 {
+		unavailable = 1
+	}
+	return surge, unavailable
+}
+
+// Progress of a rolling replacement
+type RolloutInfo struct {
+	Generation int        `json:"generation"`
+	Status     string     `json:"status"`
+	Started    time.Time  `json:"started"`
+	Finished   *time.Time `json:"finished,omitempty"`
+	Total      int        `json:"total"`
+	Updated    int        `json:"updated"`
+	Surge      int        `json:"surge"`
+	Stopping   int        `json:"stopping"`
+	// Replacements failed to start, each one delays the rollout
+	StartFailures int `json:"start_failures"`
+}
+
+// isSpawnChanged returns whether workers must be replaced to apply the settings
+func (pool *Pool) isSpawnChanged(settings PoolSettings) bool {
+	return pool.Settings.Cmd != settings.Cmd || !reflect.DeepEqual(pool.Settings.SpawnSettings, settings.SpawnSettings)
+}
+
+// startRollout switches the pool to the new command and options, running workers are replaced gradually
+func (pool *Pool) startRollout(settings PoolSettings, options task.Options) {
+	pool.logger.Info("Instant pool %v rollout to %v", pool.Settings.Cmd, settings.Cmd)
+	worker := task.New(settings.Cmd, options, pool.taskNotifications)
+	pool.Workers = worker
+	pool.Settings.Cmd = settings.Cmd
+	pool.Settings.SpawnSettings = settings.SpawnSettings
+	pool.generation += 1
+	pool.rolloutHold = false
+	pool.rolloutFailures = 0
+	pool.rollout = &RolloutInfo{
+		Generation: pool.generation,
+		Status:     RolloutInProgress,
+		Started:    pool.clock.Now(),
+	}
+}
+
+// rolloutStep replaces outdated workers within max_surge and max_unavailable limits
+func (pool *Pool) rolloutStep() {
+	if pool.rollout == nil {
+		return
+	}
+	if pool.rollout.Status != RolloutInProgress || pool.rolloutHold {
+		pool.updateRollout()
+		return
+	}
+	maxSurge, maxUnavailable := pool.Settings.RolloutSettings.limits()
+	surge := len(pool.surge)
+	stopping := 0
+	var outdated []int
+	for index, s := range pool.slots {
+		if s.stopping {
+			stopping += 1
+		}
+		if s.generation < pool.generation && s.pid != 0 && !s.recycling && !s.stopping && index < pool.Settings.Count {
+			outdated = append(outdated, index)
+		}
+	}
+	sort.Ints(outdated)
+	for _, index := range outdated {
+		s := pool.slots[index]
+		if surge < maxSurge {
+			s.recycling = true
+			s.rollout = true
+			pool.surge[index] = pool.exec(index)
+			surge += 1
+		} else if stopping < maxUnavailable {
+			s.stopping = true
+			s.task.CancelPid(s.pid)
+			stopping += 1
+		}
+	}
+	pool.updateRollout()
+}
+
+func (pool *Pool) updateRollout() {
+	if pool.rollout == nil {
+		return
+	}
+	info := *pool.rollout
+	info.Total = pool.Settings.Count
+	info.Updated = 0
+	info.Surge = len(pool.surge)
+	info.Stopping = 0
+	info.StartFailures = pool.rolloutFailures
+	outdated := 0
+	for _, s := range pool.slots {
+		if s.stopping {
+			info.Stopping += 1
+		}
+		if s.generation < pool.generation {
+			outdated += 1
+		} else if s.pid != 0 {
+			info.Updated += 1
+		}
+	}
+	if info.Status == RolloutInProgress && outdated == 0 && len(pool.surge) == 0 && info.Updated >= info.Total {
+		now := pool.clock.Now()
+		info.Status = RolloutDone
+		info.Finished = &now
+		pool.logger.Info("Instant pool %v rollout done", pool.Settings.Cmd)
+	}
+	pool.rollout = &info
+	pool.infoMutex.Lock()
+	pool.rolloutInfo = &info
+	pool.infoMutex.Unlock()
+}
+
+func (pool *Pool) getRollout() *RolloutInfo {
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	return pool.rolloutInfo
+}
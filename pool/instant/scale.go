@@ -0,0 +1,183 @@
+package instant
+
+import (
+	"fmt"
+	"github.com/robfig/cron"
+	"github.com/stepan-s/jobro/clock"
+	"time"
+)
+
+// How far to look back for the active scale rule
+const scaleLookback = 8 * 24 * time.Hour
+const scaleLookbackSteps = 100000
+
+// Workers count since the cron fire time
+type ScaleRule struct {
+	Cron     string `json:"cron"`
+	Count    int    `json:"count"`
+	Timezone string `json:"timezone"`
+}
+
+func (rule ScaleRule) schedule(location *time.Location) (cron.Schedule, error) {
+	if rule.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(rule.Timezone)
+		if err != nil {
+			return nil, err
+		}
+	}
+	schedule, err := clock.NewZonedSchedule(rule.Cron, location)
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (rule ScaleRule) Validate() error {
+	if rule.Count < 0 {
+		return fmt.Errorf("scale rule %v: negative count", rule.Cron)
+	}
+	if _, err := rule.schedule(time.UTC); err != nil {
+		return fmt.Errorf("scale rule %v: %v", rule.Cron, err)
+	}
+	return nil
+}
+
+// Manual count, it takes precedence until expired
+type Override struct {
+	Count int       `json:"count"`
+	Until time.Time `json:"until"`
+}
+
+// Scaling state of a pool
+type ScaleInfo struct {
+	// Count by the config, scale rules or autoscale
+	Base     int        `json:"base"`
+	Rule     *ScaleRule `json:"rule,omitempty"`
+	Override *Override  `json:"override,omitempty"`
+}
+
+type scaleJob struct {
+	rule  ScaleRule
+	scale chan PoolScaleCommand
+	done  chan struct{}
+}
+
+func (job scaleJob) Run() {
+	select {
+	case job.scale <- PoolScaleCommand{rule: job.rule}:
+	case <-job.done:
+	}
+}
+
+// lastFire returns the last fire time of the schedule not after now
+func lastFire(schedule cron.Schedule, now time.Time) (time.Time, bool) {
+	var last time.Time
+	t := now.Add(-scaleLookback)
+	for i := 0; i < scaleLookbackSteps; i += 1 {
+		next := schedule.Next(t)
+		if next.IsZero() || next.After(now) {
+			break
+		}
+		last = next
+		t = next
+	}
+	return last, !last.IsZero()
+}
+
+// activeRule returns the rule fired last
+func activeRule(rules []ScaleRule, location *time.Location, now time.Time) *ScaleRule {
+	var active *ScaleRule
+	var activeFire time.Time
+	for i, rule := range rules {
+		schedule, err := rule.schedule(location)
+		if err != nil {
+			continue
+		}
+		if fire, ok := lastFire(schedule, now); ok && fire.After(activeFire) {
+			active = &rules[i]
+			activeFire = fire
+		}
+	}
+	return active
+}
+
+// startScaleRules schedules the rules of the pool
+func (pool *Pool) startScaleRules() {
+	if pool.scaleCron != nil {
+		pool.scaleCron.Stop()
+		pool.scaleCron = nil
+	}
+	pool.scaleRule = nil
+	if len(pool.Settings.Scale) == 0 {
+		return
+	}
+	pool.scaleRule = activeRule(pool.Settings.Scale, pool.location, pool.clock.Now())
+	pool.scaleCron = clock.NewCron(pool.clock)
+	for _, rule := range pool.Settings.Scale {
+		schedule, err := rule.schedule(pool.location)
+		if err != nil {
+			pool.logger.Error("Instant pool %v scale rule %v, error: %v", pool.Settings.Cmd, rule.Cron, err)
+			continue
+		}
+		pool.scaleCron.Schedule(schedule, scaleJob{rule, pool.scaleChan, pool.done})
+	}
+	pool.scaleCron.Start()
+}
+
+// applyCount sets the count by the override if active or by the base count
+func (pool *Pool) applyCount() {
+	count := pool.baseCount
+	if pool.override != nil {
+		if pool.clock.Now().Before(pool.override.Until) {
+			count = pool.override.Count
+		} else {
+			pool.logger.Info("Instant pool %v count override expired", pool.Settings.Cmd)
+			pool.override = nil
+		}
+	}
+	pool.updateScaleInfo()
+	pool.setCount(count)
+}
+
+func (pool *Pool) setOverride(count int, ttl time.Duration) {
+	if pool.overrideTimer != nil {
+		pool.overrideTimer.Stop()
+		pool.overrideTimer = nil
+	}
+	if ttl <= 0 {
+		pool.logger.Info("Instant pool %v count override reset", pool.Settings.Cmd)
+		pool.override = nil
+	} else {
+		pool.logger.Info("Instant pool %v count override %d for %v", pool.Settings.Cmd, count, ttl)
+		pool.override = &Override{Count: count, Until: pool.clock.Now().Add(ttl)}
+		pool.overrideTimer = pool.clock.AfterFunc(ttl, func() {
+			select {
+			case pool.scaleChan <- PoolScaleCommand{}:
+			case <-pool.done:
+			}
+		})
+	}
+	pool.applyCount()
+}
+
+func (pool *Pool) updateScaleInfo() {
+	info := &ScaleInfo{Base: pool.baseCount}
+	if pool.scaleRule != nil {
+		rule := *pool.scaleRule
+		info.Rule = &rule
+	}
+	if pool.override != nil {
+		override := *pool.override
+		info.Override = &override
+	}
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	pool.scaleInfo = info
+}
+
+func (pool *Pool) getScale() *ScaleInfo {
+	pool.infoMutex.Lock()
+	defer pool.infoMutex.Unlock()
+	return pool.scaleInfo
+}
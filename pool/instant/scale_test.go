@@ -0,0 +1,58 @@
+package instant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScaleRulesAndOverride(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{
+		Name:  "a",
+		Cmd:   "a",
+		Count: 2,
+		Scale: []ScaleRule{
+			{Cron: "0 0 9 * * *", Count: 3},
+			{Cron: "0 0 18 * * *", Count: 1},
+		},
+	}}, nil)
+	// The evening rule of the previous day is active at midnight
+	p.waitRunning("a", 1)
+	if rule := p.info("a").Scale.Rule; rule == nil || rule.Count != 1 {
+		t.Errorf("active rule %+v, want the evening rule", rule)
+	}
+
+	p.clock.Advance(9 * time.Hour)
+	p.waitRunning("a", 3)
+
+	if !p.Override("a", 5, time.Hour) {
+		t.Fatalf("pool is not found by name")
+	}
+	p.waitRunning("a", 5)
+	p.eventually("override", func() bool {
+		return p.info("a").Scale.Override != nil
+	})
+	p.clock.Advance(time.Hour)
+	p.waitRunning("a", 3)
+	if scale := p.info("a").Scale; scale.Override != nil || scale.Base != 3 {
+		t.Errorf("scale %+v, want the base count 3 without override", scale)
+	}
+
+	if p.Override("b", 1, time.Hour) {
+		t.Errorf("override of a missing pool")
+	}
+	p.stop()
+}
+
+func TestOverrideReset(t *testing.T) {
+	p := newTestPools(t)
+	p.SetTasks([]PoolSettings{{Name: "a", Cmd: "a", Count: 1}}, nil)
+	p.waitRunning("a", 1)
+	id := p.info("a").Id.String()
+
+	p.Override(id, 2, time.Hour)
+	p.waitRunning("a", 2)
+	p.Override(id, 0, 0)
+	p.waitRunning("a", 1)
+	p.stop()
+}
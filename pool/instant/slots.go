@@ -0,0 +1,119 @@
+package instant
+
+import (
+	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/pool/task"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Values for templates of the pool command and health check
+type WorkerVars struct {
+	Index int
+	Count int
+}
+
+// Worker slot, the index is reused when the worker restarts
+type slot struct {
+	run     uuid.UUID
+	pid     int
+	started time.Time
+	// Task of the worker, it is replaced on rollout
+	task       *task.Task
+	generation int
+	// The worker is replaced by the surge worker of the slot
+	recycling bool
+	// The worker is replaced because of the rollout
+	rollout bool
+	// The worker is stopped to be replaced
+	stopping bool
+}
+
+func (pool *Pool) spawn(index int) {
+	pool.slots[index] = pool.exec(index)
+}
+
+func (pool *Pool) exec(index int) *slot {
+	run := uuid.New()
+	go pool.Workers.Exec(task.Run{
+		Id:          run,
+		Description: "instant",
+		Group:       pool.Settings.Group,
+		Env: []string{
+			"JOBRO_WORKER_INDEX=" + strconv.Itoa(index),
+			"JOBRO_WORKER_COUNT=" + strconv.Itoa(pool.Settings.Count),
+		},
+		Vars: WorkerVars{Index: index, Count: pool.Settings.Count},
+	})
+	return &slot{run: run, task: pool.Workers, generation: pool.generation}
+}
+
+// spawnMissing starts workers of free slots
+func (pool *Pool) spawnMissing() {
+	for index := 0; index < pool.Settings.Count; index += 1 {
+		if _, ok := pool.slots[index]; !ok {
+			pool.spawn(index)
+		}
+	}
+}
+
+// stopExtra stops workers of slots out of the count, the highest slots first
+func (pool *Pool) stopExtra() {
+	var extra []int
+	for index, s := range pool.slots {
+		if index >= pool.Settings.Count && s.pid != 0 {
+			extra = append(extra, index)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(extra)))
+	for _, index := range extra {
+		if s, ok := pool.surge[index]; ok && s.pid != 0 {
+			s.task.CancelPid(s.pid)
+		}
+		pool.slots[index].task.CancelPid(pool.slots[index].pid)
+	}
+}
+
+// findSlot finds the slot of the run, surge is true for replacement workers
+func (pool *Pool) findSlot(run uuid.UUID) (index int, s *slot, surge bool) {
+	for index, s := range pool.slots {
+		if s.run == run {
+			return index, s, false
+		}
+	}
+	for index, s := range pool.surge {
+		if s.run == run {
+			return index, s, true
+		}
+	}
+	return 0, nil, false
+}
+
+// active returns the number of workers including starting and surge ones
+func (pool *Pool) active() int {
+	return len(pool.slots) + len(pool.surge)
+}
+
+// cancelPid stops the worker with the task started it
+func (pool *Pool) cancelPid(pid int) {
+	for _, workers := range []map[int]*slot{pool.slots, pool.surge} {
+		for _, s := range workers {
+			if s.pid == pid {
+				s.task.CancelPid(pid)
+				return
+			}
+		}
+	}
+}
+
+// cancelAll stops all workers of the pool
+func (pool *Pool) cancelAll() {
+	for _, workers := range []map[int]*slot{pool.slots, pool.surge} {
+		for _, s := range workers {
+			if s.pid != 0 {
+				s.task.CancelPid(s.pid)
+			}
+		}
+	}
+}
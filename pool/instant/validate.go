@@ -0,0 +1,46 @@
+package instant
+
+import (
+	"fmt"
+	"github.com/stepan-s/jobro/pool/group"
+	"github.com/stepan-s/jobro/pool/task"
+)
+
+// Validate checks the pools settings before applying, pools are not allowed in groups limiting concurrent runs
+func Validate(settings []PoolSettings, groups map[string]group.Settings) error {
+	names := map[string]bool{}
+	for _, set := range settings {
+		if names[set.GetName()] {
+			return fmt.Errorf("duplicate instant pool name: %v", set.GetName())
+		}
+		names[set.GetName()] = true
+		if limits, ok := groups[set.Group]; ok && limits.MaxConcurrent > 0 {
+			return fmt.Errorf("instant pool %v: group %v limits concurrent runs, use count instead", set.GetName(), set.Group)
+		}
+		if _, err := set.SpawnSettings.Options(); err != nil {
+			return fmt.Errorf("instant pool %v: %v", set.Cmd, err)
+		}
+		if _, err := task.ExpandCmd(set.Cmd, WorkerVars{}); err != nil {
+			return fmt.Errorf("instant pool %v: cmd template: %v", set.Cmd, err)
+		}
+		if err := set.RecycleSettings.Validate(); err != nil {
+			return fmt.Errorf("instant pool %v: %v", set.Cmd, err)
+		}
+		for _, rule := range set.Scale {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("instant pool %v: %v", set.Cmd, err)
+			}
+		}
+		if set.Autoscale != nil {
+			if err := set.Autoscale.Validate(); err != nil {
+				return fmt.Errorf("instant pool %v: %v", set.Cmd, err)
+			}
+		}
+		if set.HealthCheck != nil {
+			if err := set.HealthCheck.Validate(); err != nil {
+				return fmt.Errorf("instant pool %v: %v", set.Cmd, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package instant
+
+import (
+	"github.com/stepan-s/jobro/pool/group"
+	"testing"
+)
+
+func TestValidateDuplicateNames(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings []PoolSettings
+		err      bool
+	}{
+		{"distinct", []PoolSettings{{Name: "a", Cmd: "x"}, {Name: "b", Cmd: "x"}}, false},
+		{"named", []PoolSettings{{Name: "a", Cmd: "x"}, {Name: "a", Cmd: "y"}}, true},
+		{"unnamed", []PoolSettings{{Cmd: "x"}, {Cmd: "x", Count: 2}}, true},
+		{"name equals cmd", []PoolSettings{{Name: "x", Cmd: "y"}, {Cmd: "x"}}, true},
+	}
+	for _, c := range cases {
+		err := Validate(c.settings, nil)
+		if (err != nil) != c.err {
+			t.Errorf("%v: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestValidateLimitedGroup(t *testing.T) {
+	groups := map[string]group.Settings{
+		"limited":   {MaxConcurrent: 2},
+		"readiness": {Readiness: group.Readiness{MinReady: 1}},
+	}
+	if err := Validate([]PoolSettings{{Cmd: "a", Group: "readiness"}, {Cmd: "b", Group: "unknown"}}, groups); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := Validate([]PoolSettings{{Cmd: "a", Group: "limited"}}, groups); err == nil {
+		t.Errorf("pool in a group with max_concurrent is accepted")
+	}
+}
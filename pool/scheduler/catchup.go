@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"github.com/stepan-s/jobro/clock"
+	"time"
+)
+
+const CatchupNone = "none"
+const CatchupOnce = "once"
+const CatchupAll = "all"
+
+// Default cap for the "all" catch-up policy
+const defaultCatchupLimit = 10
+
+// Protects from endless iteration over very frequent schedules
+const catchupMaxSteps = 100000
+
+// missedFires returns fire times missed between last and now, according to the task catch-up policy
+func missedFires(set TaskSettings, schedule *clock.ZonedSchedule, last time.Time, now time.Time) []time.Time {
+	if set.Catchup == "" || set.Catchup == CatchupNone || last.IsZero() {
+		return nil
+	}
+	limit := 1
+	if set.Catchup == CatchupAll {
+		limit = set.CatchupLimit
+		if limit <= 0 {
+			limit = defaultCatchupLimit
+		}
+	}
+
+	from := last
+	deadline := set.StartingDeadline.Duration()
+	if deadline > 0 && now.Add(-deadline).After(from) {
+		from = now.Add(-deadline)
+	}
+
+	var missed []time.Time
+	next := schedule.Next(from)
+	for step := 0; !next.IsZero() && next.Before(now) && step < catchupMaxSteps; step += 1 {
+		missed = append(missed, next)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+		next = schedule.Next(next)
+	}
+	return missed
+}
@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/pool/task"
+	"testing"
+	"time"
+)
+
+func TestMissedFires(t *testing.T) {
+	schedule, err := clock.NewZonedSchedule("0 0 * * * *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		name string
+		set  TaskSettings
+		last time.Time
+		now  time.Time
+		want []int
+	}{
+		{"no policy", TaskSettings{}, at(0, 30), at(5, 10), nil},
+		{"none", TaskSettings{Catchup: CatchupNone}, at(0, 30), at(5, 10), nil},
+		{"never fired", TaskSettings{Catchup: CatchupAll}, time.Time{}, at(5, 10), nil},
+		{"nothing missed", TaskSettings{Catchup: CatchupAll}, at(0, 30), at(0, 50), nil},
+		{"once runs the last", TaskSettings{Catchup: CatchupOnce}, at(0, 30), at(5, 10), []int{5}},
+		{"all", TaskSettings{Catchup: CatchupAll}, at(0, 30), at(5, 10), []int{1, 2, 3, 4, 5}},
+		{"all keeps the last by limit", TaskSettings{Catchup: CatchupAll, CatchupLimit: 2}, at(0, 30), at(5, 10), []int{4, 5}},
+		{"default limit", TaskSettings{Catchup: CatchupAll}, at(0, 30), at(13, 10), []int{4, 5, 6, 7, 8, 9, 10, 11, 12, 13}},
+		{"starting deadline", TaskSettings{Catchup: CatchupAll, StartingDeadline: task.Duration(150 * time.Minute)}, at(0, 30), at(5, 10), []int{3, 4, 5}},
+		{"fire at now is not missed", TaskSettings{Catchup: CatchupAll}, at(3, 30), at(5, 0), []int{4}},
+	}
+	for _, c := range cases {
+		missed := missedFires(c.set, schedule, c.last, c.now)
+		var hours []int
+		for _, fire := range missed {
+			hours = append(hours, fire.Hour())
+		}
+		if len(hours) != len(c.want) {
+			t.Errorf("%v: missed %v, want hours %v", c.name, missed, c.want)
+			continue
+		}
+		for i := range hours {
+			if hours[i] != c.want[i] {
+				t.Errorf("%v: missed %v, want hours %v", c.name, missed, c.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/pool/group"
+	"github.com/stepan-s/jobro/pool/task"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type testScheduler struct {
+	*Scheduler
+	t      *testing.T
+	clock  *clock.Fake
+	runner *task.FakeRunner
+}
+
+func newTestScheduler(t *testing.T, tasks []TaskSettings, groups map[string]group.Settings) *testScheduler {
+	return newTestSchedulerWith(t, Options{}, tasks, groups)
+}
+
+// newTestSchedulerWith creates the scheduler with the fake clock and runner and other options
+func newTestSchedulerWith(t *testing.T, options Options, tasks []TaskSettings, groups map[string]group.Settings) *testScheduler {
+	fake := clock.NewFake(testStart)
+	runner := task.NewFakeRunner()
+	options.Hostname = "test"
+	options.Location = time.UTC
+	options.Clock = fake
+	options.Runner = runner
+	s := &testScheduler{
+		Scheduler: New(options),
+		t:         t,
+		clock:     fake,
+		runner:    runner,
+	}
+	s.SetTasks(tasks, groups)
+	// Wait while the tasks are applied
+	s.GetInfo()
+	return s
+}
+
+// eventually fails the test if the condition is not met soon
+func (s *testScheduler) eventually(what string, condition func() bool) {
+	s.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timeout waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *testScheduler) info(name string) TaskInfo {
+	s.t.Helper()
+	for _, info := range s.GetInfo() {
+		if info.Settings.GetName() == name {
+			return info
+		}
+	}
+	s.t.Fatalf("task %v not found", name)
+	return TaskInfo{}
+}
+
+func (s *testScheduler) run(name string) {
+	s.RunTask(s.info(name).Id)
+}
+
+// waitRunning waits for the number of running fake processes
+func (s *testScheduler) waitRunning(count int) []*task.FakeProcess {
+	s.t.Helper()
+	s.eventually("running processes", func() bool {
+		return len(s.runner.Running()) == count && s.GetRunning() == int64(count)
+	})
+	return s.runner.Running()
+}
+
+// statuses returns statuses of the task runs from the oldest
+func (s *testScheduler) statuses(name string) []string {
+	var statuses []string
+	for _, run := range s.info(name).History {
+		statuses = append(statuses, run.Status)
+	}
+	return statuses
+}
+
+func (s *testScheduler) waitStatuses(name string, want ...string) {
+	s.t.Helper()
+	s.eventually("statuses of "+name, func() bool {
+		got := s.statuses(name)
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// sync waits while the main loop handles the previous commands
+func (s *testScheduler) sync() {
+	s.t.Helper()
+	if !s.Ping(time.Second) {
+		s.t.Fatalf("scheduler does not respond")
+	}
+}
+
+// stop stops the scheduler in background, the channel is closed when it is stopped
+func (s *testScheduler) stop() chan bool {
+	done := make(chan bool)
+	go func() {
+		_ = s.Stop(context.Background())
+		close(done)
+	}()
+	return done
+}
+
+func isClosed(done chan bool) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
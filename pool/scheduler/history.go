@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/pool/task"
+	"time"
+)
+
+// How many runs to keep per task
+const historyLimit = 20
+
+const TriggerScheduled = "scheduled"
+const TriggerManual = "manual"
+const TriggerCatchup = "catchup"
+const TriggerRetry = "retry"
+const TriggerDependency = "dependency"
+
+const RunDelayed = "delayed"
+const RunPending = "pending"
+const RunQueued = "queued"
+const RunSkipped = "skipped"
+const RunDropped = "dropped"
+const RunLimitKilled = "limit_killed"
+const RunRunning = "running"
+const RunDone = "done"
+const RunFailed = "failed"
+const RunFailStart = "fail_start"
+const RunCancelled = "cancelled"
+
+type RunRecord struct {
+	Id        uuid.UUID     `json:"id"`
+	Trigger   string        `json:"trigger"`
+	Status    string        `json:"status"`
+	Scheduled time.Time     `json:"scheduled"`
+	Delay     task.Duration `json:"delay"`
+	Started   *time.Time    `json:"started,omitempty"`
+	Finished  *time.Time    `json:"finished,omitempty"`
+	Pid       int           `json:"pid,omitempty"`
+	ExitCode  *int          `json:"exit_code,omitempty"`
+	TimedOut  bool          `json:"timed_out,omitempty"`
+	Attempt   int           `json:"attempt"`
+	RetryOf   *uuid.UUID    `json:"retry_of,omitempty"`
+	Workflow  *uuid.UUID    `json:"workflow,omitempty"`
+	Priority  int           `json:"priority,omitempty"`
+	QueuedAt  *time.Time    `json:"queued,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	Leftover  []int         `json:"leftover,omitempty"`
+	Killed    bool          `json:"killed,omitempty"`
+	Exit      *task.Exit    `json:"exit,omitempty"`
+	timer     clock.Timer
+	timeout   clock.Timer
+	group     string
+}
+
+type history struct {
+	runs []*RunRecord
+}
+
+func (h *history) add(run *RunRecord) {
+	h.runs = append(h.runs, run)
+	if len(h.runs) > historyLimit {
+		h.runs = h.runs[len(h.runs)-historyLimit:]
+	}
+}
+
+func (h *history) find(id uuid.UUID) *RunRecord {
+	for _, run := range h.runs {
+		if run.Id == id {
+			return run
+		}
+	}
+	return nil
+}
+
+func (h *history) list() []RunRecord {
+	list := make([]RunRecord, 0, len(h.runs))
+	for _, run := range h.runs {
+		list = append(list, *run)
+	}
+	return list
+}
+
+func (run *RunRecord) isSucceeded() bool {
+	return run.Status == RunDone && !run.TimedOut
+}
+
+func (run *RunRecord) start(pid int, now time.Time) {
+	run.Status = RunRunning
+	run.Started = &now
+	run.Pid = pid
+}
+
+func (run *RunRecord) finish(status string, now time.Time) {
+	run.Status = status
+	run.Finished = &now
+	if run.timeout != nil {
+		run.timeout.Stop()
+	}
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// spreadOffset returns a stable offset inside the window for the host and task pair
+func spreadOffset(hostname string, name string, window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(hostname + "/" + name))
+	return time.Duration(hash.Sum64() % uint64(window))
+}
+
+func (scheduler *Scheduler) delay(cronTask *CronTask) time.Duration {
+	window := cronTask.Settings.Jitter.Duration()
+	if window <= 0 {
+		return 0
+	}
+	if cronTask.Settings.Spread {
+		return spreadOffset(scheduler.options.Hostname, cronTask.Settings.GetName(), window)
+	}
+	return time.Duration(scheduler.random.Int63n(int64(window)))
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpreadOffset(t *testing.T) {
+	cases := []struct {
+		name   string
+		host   string
+		task   string
+		window time.Duration
+	}{
+		{"minute", "web-1", "cleanup", time.Minute},
+		{"hour", "web-1", "cleanup", time.Hour},
+		{"tiny", "web-1", "cleanup", time.Nanosecond},
+		{"empty names", "", "", time.Second},
+	}
+	for _, c := range cases {
+		offset := spreadOffset(c.host, c.task, c.window)
+		if offset < 0 || offset >= c.window {
+			t.Errorf("%v: offset %v is out of the window %v", c.name, offset, c.window)
+		}
+		if again := spreadOffset(c.host, c.task, c.window); again != offset {
+			t.Errorf("%v: offset %v is not stable, got %v", c.name, offset, again)
+		}
+	}
+
+	for _, window := range []time.Duration{0, -time.Second} {
+		if offset := spreadOffset("web-1", "cleanup", window); offset != 0 {
+			t.Errorf("offset %v for window %v, want 0", offset, window)
+		}
+	}
+
+	// Replicas of a task are spread over the window
+	offsets := map[time.Duration]bool{}
+	for _, host := range []string{"web-1", "web-2", "web-3", "web-4", "web-5"} {
+		offsets[spreadOffset(host, "cleanup", time.Hour)] = true
+	}
+	if len(offsets) < 4 {
+		t.Errorf("offsets of 5 hosts %v, want them spread", offsets)
+	}
+}
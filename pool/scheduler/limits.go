@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/pool/task"
+	"sort"
+)
+
+type GroupInfo struct {
+	Name          string `json:"name"`
+	MaxConcurrent int    `json:"max_concurrent"`
+	Policy        string `json:"policy"`
+	Running       int    `json:"running"`
+	Queued        int    `json:"queued"`
+}
+
+func (scheduler *Scheduler) hasSlot(groupName string) bool {
+	if max := scheduler.options.MaxConcurrent; max > 0 && len(scheduler.active) >= max {
+		return false
+	}
+	if set, ok := scheduler.groups[groupName]; ok && set.MaxConcurrent > 0 && scheduler.groupRunning[groupName] >= set.MaxConcurrent {
+		return false
+	}
+	return true
+}
+
+func (scheduler *Scheduler) acquire(groupName string, run *RunRecord) {
+	run.group = groupName
+	scheduler.active[run.Id] = run
+	scheduler.groupRunning[groupName] += 1
+}
+
+func (scheduler *Scheduler) release(id uuid.UUID) {
+	run, ok := scheduler.active[id]
+	if !ok {
+		return
+	}
+	delete(scheduler.active, id)
+	scheduler.groupRunning[run.group] -= 1
+	if scheduler.groupRunning[run.group] <= 0 {
+		delete(scheduler.groupRunning, run.group)
+	}
+	scheduler.dequeue()
+}
+
+func (scheduler *Scheduler) exec(cronTask *CronTask, run *RunRecord) {
+	scheduler.acquire(cronTask.Settings.Group, run)
+	run.Status = RunPending
+	go cronTask.Task.Exec(task.Run{Id: run.Id, Description: run.Trigger, Group: cronTask.Settings.Group})
+}
+
+func (scheduler *Scheduler) getGroups() []GroupInfo {
+	queued := map[string]int{}
+	for _, item := range scheduler.queue {
+		queued[item.cronTask.Settings.Group] += 1
+	}
+	names := map[string]bool{}
+	for name := range scheduler.groups {
+		names[name] = true
+	}
+	for name := range scheduler.groupRunning {
+		names[name] = true
+	}
+	for name := range queued {
+		names[name] = true
+	}
+	var info []GroupInfo
+	for name := range names {
+		set := scheduler.groups[name]
+		info = append(info, GroupInfo{
+			Name:          name,
+			MaxConcurrent: set.MaxConcurrent,
+			Policy:        set.GetPolicy(),
+			Running:       scheduler.groupRunning[name],
+			Queued:        queued[name],
+		})
+	}
+	sort.Slice(info, func(i, j int) bool {
+		return info[i].Name < info[j].Name
+	})
+	return info
+}
@@ -0,0 +1,179 @@
+package scheduler
+
+import (
+	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/pool/group"
+	"time"
+)
+
+// Reasons to drop a run
+const ReasonNoSlot = "no free slot"
+const ReasonQueueFull = "queue full"
+const ReasonMaxWait = "max wait exceeded"
+const ReasonCancelled = "cancelled by api"
+
+type QueueInfo struct {
+	Run      uuid.UUID `json:"run"`
+	Task     uuid.UUID `json:"task"`
+	Name     string    `json:"name"`
+	Group    string    `json:"group"`
+	Trigger  string    `json:"trigger"`
+	Priority int       `json:"priority"`
+	Queued   time.Time `json:"queued"`
+}
+
+type queuedRun struct {
+	cronTask *CronTask
+	run      *RunRecord
+}
+
+func (scheduler *Scheduler) maxQueue(groupName string) int {
+	if set, ok := scheduler.groups[groupName]; ok && set.MaxQueue > 0 {
+		return set.MaxQueue
+	}
+	return scheduler.options.MaxQueue
+}
+
+func (scheduler *Scheduler) maxWait(groupName string) time.Duration {
+	if set, ok := scheduler.groups[groupName]; ok && set.MaxWait > 0 {
+		return set.MaxWait.Duration()
+	}
+	return scheduler.options.MaxWait
+}
+
+func (scheduler *Scheduler) launch(cronTask *CronTask, run *RunRecord) {
+	groupName := cronTask.Settings.Group
+	if scheduler.hasSlot(groupName) {
+		scheduler.exec(cronTask, run)
+		return
+	}
+	if scheduler.groups[groupName].GetPolicy() == group.PolicySkip {
+		scheduler.logger.Warning("No free slot for task %v in group '%v', run %v skipped", cronTask.Settings.GetName(), groupName, run.Id)
+		run.Reason = ReasonNoSlot
+		run.finish(RunSkipped, scheduler.clock.Now())
+		scheduler.complete(cronTask, run)
+		return
+	}
+	scheduler.enqueue(cronTask, run)
+}
+
+// enqueue puts the run to the queue ordered by priority, the lowest priority run is dropped if the queue is full
+func (scheduler *Scheduler) enqueue(cronTask *CronTask, run *RunRecord) {
+	groupName := cronTask.Settings.Group
+	now := scheduler.clock.Now()
+	run.Status = RunQueued
+	run.Priority = cronTask.Settings.Priority
+	run.QueuedAt = &now
+
+	if limit := scheduler.maxQueue(groupName); limit > 0 {
+		count := 0
+		var victim *queuedRun
+		for i := range scheduler.queue {
+			item := &scheduler.queue[i]
+			if item.cronTask.Settings.Group == groupName {
+				count += 1
+				victim = item
+			}
+		}
+		if count >= limit {
+			if victim.run.Priority >= run.Priority {
+				scheduler.drop(cronTask, run, ReasonQueueFull)
+				return
+			}
+			scheduler.drop(victim.cronTask, scheduler.removeQueued(victim.run.Id).run, ReasonQueueFull)
+		}
+	}
+
+	position := len(scheduler.queue)
+	for i, item := range scheduler.queue {
+		if item.run.Priority < run.Priority {
+			position = i
+			break
+		}
+	}
+	scheduler.queue = append(scheduler.queue, queuedRun{})
+	copy(scheduler.queue[position+1:], scheduler.queue[position:])
+	scheduler.queue[position] = queuedRun{cronTask, run}
+	scheduler.logger.Info("No free slot for task %v in group '%v', run %v queued", cronTask.Settings.GetName(), groupName, run.Id)
+
+	if wait := scheduler.maxWait(groupName); wait > 0 {
+		run.timer = scheduler.clock.AfterFunc(wait, func() {
+			select {
+			case scheduler.expireChan <- ExpireCommand{id: run.Id}:
+			case <-scheduler.finished:
+			}
+		})
+	}
+}
+
+func (scheduler *Scheduler) removeQueued(id uuid.UUID) *queuedRun {
+	for i, item := range scheduler.queue {
+		if item.run.Id == id {
+			scheduler.queue = append(scheduler.queue[:i:i], scheduler.queue[i+1:]...)
+			if item.run.timer != nil {
+				item.run.timer.Stop()
+			}
+			return &item
+		}
+	}
+	return nil
+}
+
+func (scheduler *Scheduler) drop(cronTask *CronTask, run *RunRecord, reason string) {
+	scheduler.logger.Warning("Task %v run %v dropped: %v", cronTask.Settings.GetName(), run.Id, reason)
+	run.Reason = reason
+	run.finish(RunDropped, scheduler.clock.Now())
+	scheduler.complete(cronTask, run)
+}
+
+// dequeue starts queued runs while there are free slots
+func (scheduler *Scheduler) dequeue() {
+	var queue []queuedRun
+	for _, item := range scheduler.queue {
+		if scheduler.hasSlot(item.cronTask.Settings.Group) {
+			if item.run.timer != nil {
+				item.run.timer.Stop()
+			}
+			scheduler.exec(item.cronTask, item.run)
+		} else {
+			queue = append(queue, item)
+		}
+	}
+	scheduler.queue = queue
+}
+
+// cancelQueued drops queued runs of the task, or all queued runs if the task is nil
+func (scheduler *Scheduler) cancelQueued(cronTask *CronTask) {
+	var queue, cancelled []queuedRun
+	for _, item := range scheduler.queue {
+		if cronTask == nil || item.cronTask == cronTask {
+			cancelled = append(cancelled, item)
+		} else {
+			queue = append(queue, item)
+		}
+	}
+	scheduler.queue = queue
+	for _, item := range cancelled {
+		if item.run.timer != nil {
+			item.run.timer.Stop()
+		}
+		item.run.finish(RunCancelled, scheduler.clock.Now())
+		scheduler.complete(item.cronTask, item.run)
+	}
+}
+
+func (scheduler *Scheduler) getQueue() []QueueInfo {
+	list := make([]QueueInfo, 0, len(scheduler.queue))
+	for _, item := range scheduler.queue {
+		list = append(list, QueueInfo{
+			Run:      item.run.Id,
+			Task:     item.cronTask.Task.GetId(),
+			Name:     item.cronTask.Settings.GetName(),
+			Group:    item.cronTask.Settings.Group,
+			Trigger:  item.run.Trigger,
+			Priority: item.run.Priority,
+			Queued:   *item.run.QueuedAt,
+		})
+	}
+	return list
+}
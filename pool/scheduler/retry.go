@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"time"
+)
+
+const BackoffFixed = "fixed"
+const BackoffExponential = "exponential"
+
+// Defaults for retry delays
+const defaultRetryDelay = 10 * time.Second
+const defaultRetryMaxDelay = time.Hour
+
+// Conditions to retry a failed run, any failure is retried if nothing is set
+type RetryOn struct {
+	ExitCodes []int `json:"exit_codes"`
+	Timeout   bool  `json:"timeout"`
+	FailStart bool  `json:"fail_start"`
+}
+
+func (on RetryOn) isEmpty() bool {
+	return len(on.ExitCodes) == 0 && !on.Timeout && !on.FailStart
+}
+
+func (on RetryOn) match(run *RunRecord) bool {
+	if on.isEmpty() {
+		return true
+	}
+	switch {
+	case run.Status == RunFailStart:
+		return on.FailStart
+	case run.TimedOut:
+		return on.Timeout
+	case run.ExitCode != nil:
+		for _, code := range on.ExitCodes {
+			if code == *run.ExitCode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (run *RunRecord) isFailed() bool {
+	return run.Status == RunFailed || run.Status == RunFailStart || run.Status == RunLimitKilled || run.TimedOut
+}
+
+func shouldRetry(set TaskSettings, run *RunRecord) bool {
+	return run.isFailed() && run.Attempt < set.Retries && set.RetryOn.match(run)
+}
+
+// retryDelay returns the delay before the given attempt (starts from 1)
+func retryDelay(set TaskSettings, attempt int) time.Duration {
+	delay := set.RetryDelay.Duration()
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	maxDelay := set.RetryMaxDelay.Duration()
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	if set.RetryBackoff == BackoffExponential {
+		for i := 1; i < attempt && delay < maxDelay; i += 1 {
+			delay *= 2
+		}
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
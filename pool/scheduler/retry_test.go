@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"github.com/stepan-s/jobro/pool/task"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	set := TaskSettings{
+		RetryBackoff:  BackoffExponential,
+		RetryDelay:    task.Duration(10 * time.Second),
+		RetryMaxDelay: task.Duration(time.Minute),
+	}
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 3: 40 * time.Second, 4: time.Minute, 10: time.Minute} {
+		if delay := retryDelay(set, attempt); delay != want {
+			t.Errorf("attempt %d delay %v, want %v", attempt, delay, want)
+		}
+	}
+	if delay := retryDelay(TaskSettings{}, 3); delay != defaultRetryDelay {
+		t.Errorf("fixed delay %v, want %v", delay, defaultRetryDelay)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{{
+		Name:         "a",
+		Cron:         "manual",
+		Cmd:          "a",
+		Retries:      2,
+		RetryBackoff: BackoffExponential,
+		RetryDelay:   task.Duration(10 * time.Second),
+	}}, nil)
+
+	s.run("a")
+	_ = s.waitRunning(1)[0].Exit(1)
+	s.waitStatuses("a", RunFailed, RunDelayed)
+
+	s.clock.Advance(9 * time.Second)
+	if len(s.runner.Processes()) != 1 {
+		t.Fatalf("retry started before the delay")
+	}
+	s.clock.Advance(time.Second)
+	_ = s.waitRunning(1)[0].Exit(1)
+
+	// The second retry waits twice longer
+	s.waitStatuses("a", RunFailed, RunFailed, RunDelayed)
+	s.clock.Advance(19 * time.Second)
+	if len(s.runner.Processes()) != 2 {
+		t.Fatalf("second retry started before the delay")
+	}
+	s.clock.Advance(time.Second)
+	_ = s.waitRunning(1)[0].Exit(1)
+
+	s.waitStatuses("a", RunFailed, RunFailed, RunFailed)
+	info := s.info("a")
+	if info.Stats.Retried != 2 || info.Stats.FinalFailed != 1 {
+		t.Errorf("stats %+v, want 2 retried and 1 final failed", info.Stats)
+	}
+	last := info.History[2]
+	if last.Attempt != 2 || last.RetryOf == nil || *last.RetryOf != info.History[0].Id {
+		t.Errorf("last run attempt %d retry of %v, want attempt 2 of the first run", last.Attempt, last.RetryOf)
+	}
+}
+
+func TestRetryOnExitCodes(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{{
+		Name:    "a",
+		Cron:    "manual",
+		Cmd:     "a",
+		Retries: 3,
+		RetryOn: RetryOn{ExitCodes: []int{75}},
+	}}, nil)
+
+	s.run("a")
+	_ = s.waitRunning(1)[0].Exit(1)
+	s.waitStatuses("a", RunFailed)
+	if s.info("a").Stats.Retried != 0 {
+		t.Errorf("not matching exit code was retried")
+	}
+}
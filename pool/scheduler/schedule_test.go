@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"github.com/stepan-s/jobro/pool/group"
+	"github.com/stepan-s/jobro/pool/task"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCronTriggersByClock(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{
+		{Name: "minutely", Cron: "0 * * * * *", Cmd: "job --flag"},
+	}, nil)
+
+	s.clock.Advance(59 * time.Second)
+	if len(s.runner.Processes()) != 0 {
+		t.Fatalf("task started before the fire time")
+	}
+	s.clock.Advance(time.Second)
+	process := s.waitRunning(1)[0]
+	if args := process.Spec.Args; len(args) != 2 || args[0] != "job" || args[1] != "--flag" {
+		t.Errorf("args %v, want [job --flag]", args)
+	}
+
+	_ = process.Exit(0)
+	s.waitStatuses("minutely", RunDone)
+	info := s.info("minutely")
+	if info.Stats.Done != 1 || info.Stats.Errors != 0 {
+		t.Errorf("stats %+v, want 1 done", info.Stats)
+	}
+	if run := info.History[0]; run.Trigger != TriggerScheduled || !run.Scheduled.Equal(testStart.Add(time.Minute)) {
+		t.Errorf("run %v scheduled %v, want scheduled at %v", run.Trigger, run.Scheduled, testStart.Add(time.Minute))
+	}
+	if info.NextRun == nil || !info.NextRun.UTC.Equal(testStart.Add(2*time.Minute)) {
+		t.Errorf("next run %v, want %v", info.NextRun, testStart.Add(2*time.Minute))
+	}
+}
+
+func TestFailedRunRecordsExit(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{{Name: "a", Cron: "manual", Cmd: "a"}}, nil)
+	s.run("a")
+	_ = s.waitRunning(1)[0].Exit(3)
+	s.waitStatuses("a", RunFailed)
+	run := s.info("a").History[0]
+	if run.ExitCode == nil || *run.ExitCode != 3 || run.Exit == nil || run.Exit.Code != 3 {
+		t.Errorf("run exit code %v, exit %+v, want 3", run.ExitCode, run.Exit)
+	}
+	if s.GetErrors() != 1 || s.GetDone() != 1 {
+		t.Errorf("errors %d, done %d, want 1 and 1", s.GetErrors(), s.GetDone())
+	}
+}
+
+func TestSkipPolicy(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{
+		{Name: "a", Cron: "manual", Cmd: "a", Group: "g"},
+	}, map[string]group.Settings{"g": {MaxConcurrent: 1, Policy: group.PolicySkip}})
+
+	s.run("a")
+	process := s.waitRunning(1)[0]
+	s.run("a")
+	s.waitStatuses("a", RunRunning, RunSkipped)
+	_ = process.Exit(0)
+	s.waitStatuses("a", RunDone, RunSkipped)
+	if len(s.runner.Processes()) != 1 {
+		t.Errorf("skipped run was started")
+	}
+}
+
+func TestQueuePolicy(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{
+		{Name: "low", Cron: "manual", Cmd: "low", Group: "g"},
+		{Name: "high", Cron: "manual", Cmd: "high", Group: "g", Priority: 10},
+	}, map[string]group.Settings{"g": {MaxConcurrent: 1}})
+
+	s.run("low")
+	first := s.waitRunning(1)[0]
+	s.run("low")
+	s.run("high")
+	s.waitStatuses("high", RunQueued)
+	s.waitStatuses("low", RunRunning, RunQueued)
+
+	// The higher priority run starts first when the slot is free
+	_ = first.Exit(0)
+	s.waitStatuses("high", RunRunning)
+	second := s.waitRunning(1)[0]
+	if second.Spec.Args[0] != "high" {
+		t.Fatalf("started %v, want high", second.Spec.Args[0])
+	}
+	_ = second.Exit(0)
+	s.waitStatuses("low", RunDone, RunRunning)
+	_ = s.waitRunning(1)[0].Exit(0)
+	s.waitStatuses("low", RunDone, RunDone)
+}
+
+func TestQueueMaxWait(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{
+		{Name: "a", Cron: "manual", Cmd: "a", Group: "g"},
+	}, map[string]group.Settings{"g": {MaxConcurrent: 1, MaxWait: task.Duration(30 * time.Second)}})
+	s.run("a")
+	s.waitRunning(1)
+	s.run("a")
+	s.waitStatuses("a", RunRunning, RunQueued)
+	s.clock.Advance(29 * time.Second)
+	s.waitStatuses("a", RunRunning, RunQueued)
+	s.clock.Advance(time.Second)
+	s.waitStatuses("a", RunRunning, RunDropped)
+}
+
+func TestTimeoutInterruptsRun(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{
+		{Name: "a", Cron: "manual", Cmd: "a", Timeout: task.Duration(5 * time.Second)},
+	}, nil)
+	s.run("a")
+	process := s.waitRunning(1)[0]
+	s.clock.Advance(4 * time.Second)
+	if len(process.Signals()) != 0 {
+		t.Fatalf("interrupted before the timeout")
+	}
+	s.clock.Advance(time.Second)
+	s.waitRunning(0)
+	if signals := process.Signals(); len(signals) != 1 || signals[0] != syscall.SIGINT {
+		t.Errorf("signals %v, want SIGINT", signals)
+	}
+	s.waitStatuses("a", RunFailed)
+	if run := s.info("a").History[0]; !run.TimedOut {
+		t.Errorf("run is not timed out")
+	}
+}
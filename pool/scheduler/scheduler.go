@@ -1,123 +1,362 @@
 package scheduler
 
 import (
+	"context"
 	"github.com/google/uuid"
-	"github.com/robfig/cron"
+	"github.com/stepan-s/jobro/clock"
 	"github.com/stepan-s/jobro/log"
+	"github.com/stepan-s/jobro/pool/group"
 	"github.com/stepan-s/jobro/pool/task"
+	"math/rand"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type StopCommand struct {
-	onstop func()
+type StopCommand struct{}
+
+type StopTriggersCommand struct {
+	response chan bool
+}
+
+type DrainTimeoutCommand struct{}
+
+type PingCommand struct {
+	response chan bool
 }
 
 type SetScheduleCommand struct {
-	tasks []TaskSettings
+	tasks  []TaskSettings
+	groups map[string]group.Settings
 }
 
 type RunTaskCommand struct {
 	id uuid.UUID
 }
 
+type TriggerCommand struct {
+	id uuid.UUID
+}
+
+type LaunchCommand struct {
+	cronTask *CronTask
+	run      *RunRecord
+}
+
+type TimeoutCommand struct {
+	cronTask *CronTask
+	run      *RunRecord
+}
+
 type GetInfoCommand struct {
 	response chan []TaskInfo
 }
 
+type GetWorkflowsCommand struct {
+	response chan []Workflow
+}
+
+type GetGroupsCommand struct {
+	response chan []GroupInfo
+}
+
+type GetQueueCommand struct {
+	response chan []QueueInfo
+}
+
+type CancelQueuedCommand struct {
+	id       uuid.UUID
+	response chan bool
+}
+
+type ExpireCommand struct {
+	id uuid.UUID
+}
+
+type Options struct {
+	// Default time zone for tasks without own timezone setting
+	Location *time.Location
+	// Host name used to spread tasks, os.Hostname by default
+	Hostname string
+	// File to keep last fire times for catch-up, not persisted if empty
+	StateFile string
+	// Limit of concurrently running tasks, unlimited if zero
+	MaxConcurrent int
+	// Default limits of a group queue, unlimited if zero
+	MaxQueue int
+	MaxWait  time.Duration
+	// Time to wait running tasks on stop before they are interrupted
+	Drain time.Duration
+	// Spawns task processes, task.ExecRunner by default
+	Runner task.Runner
+	// Processes of the tasks, the shared registry by default
+	Registry *task.Registry
+	// Time source of triggers and timers, the real clock by default
+	Clock clock.Clock
+	// Log of the scheduler and its tasks, the global log if nil
+	Logger *log.Logger
+}
+
 type Scheduler struct {
+	// Totals are changed by the main loop atomically and read by metrics, 64-bit aligned as the first fields
+	done        int64
+	running     int64
+	failed      int64
+	errors      int64
+	retried     int64
+	finalFailed int64
+	limitKilled int64
+	exitsMutex  sync.Mutex
+	exits       task.ExitStats
+
+	options           Options
 	schedule          []*CronTask
-	done              int64
-	running           int64
-	failed            int64
-	errors            int64
-	cron              *cron.Cron
+	graph             *graph
+	workflows         []*Workflow
+	groups            map[string]group.Settings
+	groupRunning      map[string]int
+	active            map[uuid.UUID]*RunRecord
+	queue             []queuedRun
+	exit              bool
+	stopping          bool
+	finished          chan struct{}
+	clock             clock.Clock
+	logger            *log.Logger
+	cron              *clock.Cron
+	random            *rand.Rand
+	state             *state
 	taskNotifications chan task.Notify
 	stopChan          chan StopCommand
+	stopTriggersChan  chan StopTriggersCommand
+	drainTimeoutChan  chan DrainTimeoutCommand
+	pingChan          chan PingCommand
 	setChan           chan SetScheduleCommand
 	runChan           chan RunTaskCommand
+	triggerChan       chan TriggerCommand
+	launchChan        chan LaunchCommand
+	timeoutChan       chan TimeoutCommand
 	getInfoChan       chan GetInfoCommand
+	getWorkflowsChan  chan GetWorkflowsCommand
+	getGroupsChan     chan GetGroupsCommand
+	getQueueChan      chan GetQueueCommand
+	cancelQueuedChan  chan CancelQueuedCommand
+	expireChan        chan ExpireCommand
 }
 
-func New() *Scheduler {
+func New(options Options) *Scheduler {
+	if options.Location == nil {
+		options.Location = time.Local
+	}
+	if options.Clock == nil {
+		options.Clock = clock.Real
+	}
+	if options.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			options.Logger.Error("Fail get hostname: %v", err)
+		}
+		options.Hostname = hostname
+	}
 	scheduler := &Scheduler{
+		options:           options,
+		clock:             options.Clock,
+		random:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		logger:            options.Logger,
+		state:             loadState(options.StateFile, options.Logger),
 		taskNotifications: make(chan task.Notify, 100),
+		finished:          make(chan struct{}),
 		stopChan:          make(chan StopCommand, 1),
+		stopTriggersChan:  make(chan StopTriggersCommand, 1),
+		drainTimeoutChan:  make(chan DrainTimeoutCommand, 1),
+		pingChan:          make(chan PingCommand, 1),
 		setChan:           make(chan SetScheduleCommand, 1),
 		runChan:           make(chan RunTaskCommand, 100),
+		triggerChan:       make(chan TriggerCommand, 100),
+		launchChan:        make(chan LaunchCommand, 100),
+		timeoutChan:       make(chan TimeoutCommand, 100),
 		getInfoChan:       make(chan GetInfoCommand, 1),
+		getWorkflowsChan:  make(chan GetWorkflowsCommand, 1),
+		getGroupsChan:     make(chan GetGroupsCommand, 1),
+		getQueueChan:      make(chan GetQueueCommand, 1),
+		cancelQueuedChan:  make(chan CancelQueuedCommand, 1),
+		expireChan:        make(chan ExpireCommand, 100),
+		groups:            map[string]group.Settings{},
+		groupRunning:      map[string]int{},
+		active:            map[uuid.UUID]*RunRecord{},
 	}
+	scheduler.graph, _ = newGraph(nil)
 
 	// Scheduler main loop
 	go func() {
-		exit := false
-		var onstop func() = nil
+		defer close(scheduler.finished)
 	loop:
 		for {
 			select {
 			case event := <-scheduler.taskNotifications:
 				cronTask := findCronTaskByUUID(scheduler.schedule, event.Id)
+				run := scheduler.active[event.Run]
+				if run == nil && cronTask != nil {
+					run = cronTask.history.find(event.Run)
+				}
 				switch event.Action {
 				case task.Start:
-					scheduler.running += 1
+					atomic.AddInt64(&scheduler.running, 1)
 					if cronTask != nil {
 						cronTask.Stats.Running += 1
 					}
+					if run != nil {
+						run.start(event.Pid, scheduler.clock.Now())
+						scheduler.watchTimeout(cronTask, run)
+					}
 				case task.Stop:
-					scheduler.done += 1
-					scheduler.running -= 1
+					atomic.AddInt64(&scheduler.done, 1)
+					atomic.AddInt64(&scheduler.running, -1)
+					scheduler.exitsMutex.Lock()
+					scheduler.exits.Add(event.Exit)
+					scheduler.exitsMutex.Unlock()
 					if cronTask != nil {
 						cronTask.Stats.Done += 1
 						cronTask.Stats.Running -= 1
+						cronTask.Stats.ExitStats.Add(event.Exit)
+					}
+					if run != nil {
+						run.Leftover = event.Leftover
+						run.Exit = event.Exit
+						if run.Status == RunRunning {
+							run.finish(RunDone, scheduler.clock.Now())
+						} else {
+							run.finish(run.Status, scheduler.clock.Now())
+						}
+						scheduler.complete(cronTask, run)
 					}
-					if exit {
-						log.Info("Cron tasks in progress: %d", scheduler.running)
-						if scheduler.running == 0 {
-							log.Info("Scheduler tasks stopped")
-							if onstop != nil {
-								onstop()
-							}
+					scheduler.release(event.Run)
+					if scheduler.exit {
+						scheduler.logger.Info("Cron tasks in progress: %d", scheduler.GetRunning())
+						if scheduler.GetRunning() == 0 {
+							scheduler.logger.Info("Scheduler tasks stopped")
 							break loop
 						}
 					}
 				case task.FailStart:
-					scheduler.failed += 1
+					atomic.AddInt64(&scheduler.failed, 1)
 					if cronTask != nil {
 						cronTask.Stats.Failed += 1
 					}
+					if run != nil {
+						run.finish(RunFailStart, scheduler.clock.Now())
+						scheduler.complete(cronTask, run)
+					}
+					scheduler.release(event.Run)
 				case task.Error:
-					scheduler.errors += 1
+					atomic.AddInt64(&scheduler.errors, 1)
 					if cronTask != nil {
 						cronTask.Stats.Errors += 1
 					}
+					if event.Reason != "" {
+						atomic.AddInt64(&scheduler.limitKilled, 1)
+						if cronTask != nil {
+							cronTask.Stats.LimitKilled += 1
+						}
+					}
+					if run != nil {
+						code := event.ExitCode
+						run.Status = RunFailed
+						run.ExitCode = &code
+						run.Killed = event.Killed
+						if event.Reason != "" {
+							run.Status = RunLimitKilled
+							run.Reason = event.Reason
+						}
+					}
 				}
 			case setScheduleCommand := <-scheduler.setChan:
-				scheduler.setTasks(setScheduleCommand.tasks)
+				if scheduler.exit {
+					scheduler.logger.Info("Scheduler is stopping, schedule is not updated")
+					break
+				}
+				scheduler.setTasks(setScheduleCommand.tasks, setScheduleCommand.groups)
 			case runTaskCommand := <-scheduler.runChan:
 				cronTask := findCronTaskByUUID(scheduler.schedule, runTaskCommand.id)
 				if cronTask != nil {
-					go cronTask.Task.Exec("manual")
+					scheduler.trigger(cronTask, TriggerManual, scheduler.clock.Now(), 0)
 				} else {
-					log.Error("Task %v not found", runTaskCommand.id)
+					scheduler.logger.Error("Task %v not found", runTaskCommand.id)
 				}
-			case stopCommand := <-scheduler.stopChan:
-				log.Info("Scheduler stop tasks")
-				exit = true
-				if scheduler.cron != nil {
-					scheduler.cron.Stop()
-				}
-				if scheduler.running == 0 {
-					log.Info("Scheduler tasks stopped")
-					if stopCommand.onstop != nil {
-						stopCommand.onstop()
+			case triggerCommand := <-scheduler.triggerChan:
+				cronTask := findCronTaskByUUID(scheduler.schedule, triggerCommand.id)
+				if cronTask != nil && !scheduler.exit {
+					now := scheduler.clock.Now()
+					if cronTask.hasCatchup() {
+						scheduler.state.setLastFire(cronTask.Settings.GetName(), now)
 					}
+					scheduler.trigger(cronTask, TriggerScheduled, now, scheduler.delay(cronTask))
+				}
+			case launchCommand := <-scheduler.launchChan:
+				if launchCommand.run.Status != RunDelayed {
+					break
+				}
+				if scheduler.exit || findCronTaskByUUID(scheduler.schedule, launchCommand.cronTask.Task.GetId()) == nil {
+					launchCommand.run.finish(RunCancelled, scheduler.clock.Now())
+					scheduler.complete(launchCommand.cronTask, launchCommand.run)
+				} else {
+					scheduler.launch(launchCommand.cronTask, launchCommand.run)
+				}
+			case timeoutCommand := <-scheduler.timeoutChan:
+				run := timeoutCommand.run
+				if run.Status == RunRunning {
+					scheduler.logger.Warning("Task %v run %v timed out, pid %d", timeoutCommand.cronTask.Settings.GetName(), run.Id, run.Pid)
+					run.TimedOut = true
+					timeoutCommand.cronTask.Task.CancelPid(run.Pid)
+				}
+			case stopTriggersCommand := <-scheduler.stopTriggersChan:
+				scheduler.stopTriggers()
+				stopTriggersCommand.response <- true
+			case <-scheduler.stopChan:
+				scheduler.logger.Info("Scheduler stop tasks")
+				scheduler.stopTriggers()
+				if scheduler.GetRunning() == 0 {
+					scheduler.logger.Info("Scheduler tasks stopped")
 					break loop
+				}
+				// A repeated stop interrupts tasks at once
+				if drain := scheduler.options.Drain; drain > 0 && !scheduler.stopping {
+					scheduler.logger.Info("Scheduler drain %d tasks for %v", scheduler.GetRunning(), drain)
+					scheduler.clock.AfterFunc(drain, func() {
+						select {
+						case scheduler.drainTimeoutChan <- DrainTimeoutCommand{}:
+						case <-scheduler.finished:
+						}
+					})
 				} else {
-					onstop = stopCommand.onstop
-					for _, cronTask := range scheduler.schedule {
-						cronTask.Task.Cancel()
-					}
+					scheduler.cancelRunning()
 				}
+				scheduler.stopping = true
+			case <-scheduler.drainTimeoutChan:
+				scheduler.logger.Info("Scheduler drain timeout, tasks in progress: %d", scheduler.GetRunning())
+				scheduler.cancelRunning()
+			case pingCommand := <-scheduler.pingChan:
+				pingCommand.response <- true
 			case getInfoCommand := <-scheduler.getInfoChan:
 				getInfoCommand.response <- scheduler.getInfo()
+			case getWorkflowsCommand := <-scheduler.getWorkflowsChan:
+				getWorkflowsCommand.response <- scheduler.getWorkflows()
+			case getGroupsCommand := <-scheduler.getGroupsChan:
+				getGroupsCommand.response <- scheduler.getGroups()
+			case getQueueCommand := <-scheduler.getQueueChan:
+				getQueueCommand.response <- scheduler.getQueue()
+			case cancelQueuedCommand := <-scheduler.cancelQueuedChan:
+				item := scheduler.removeQueued(cancelQueuedCommand.id)
+				if item != nil {
+					scheduler.drop(item.cronTask, item.run, ReasonCancelled)
+				}
+				cancelQueuedCommand.response <- item != nil
+			case expireCommand := <-scheduler.expireChan:
+				item := scheduler.removeQueued(expireCommand.id)
+				if item != nil {
+					scheduler.drop(item.cronTask, item.run, ReasonMaxWait)
+				}
 			}
 		}
 	}()
@@ -125,73 +364,406 @@ func New() *Scheduler {
 }
 
 func (scheduler *Scheduler) GetDone() int64 {
-	return scheduler.done
+	return atomic.LoadInt64(&scheduler.done)
 }
 
 func (scheduler *Scheduler) GetRunning() int64 {
-	return scheduler.running
+	return atomic.LoadInt64(&scheduler.running)
 }
 
 func (scheduler *Scheduler) GetFailed() int64 {
-	return scheduler.failed
+	return atomic.LoadInt64(&scheduler.failed)
 }
 
 func (scheduler *Scheduler) GetErrors() int64 {
-	return scheduler.errors
+	return atomic.LoadInt64(&scheduler.errors)
+}
+
+func (scheduler *Scheduler) GetRetried() int64 {
+	return atomic.LoadInt64(&scheduler.retried)
+}
+
+func (scheduler *Scheduler) GetFinalFailed() int64 {
+	return atomic.LoadInt64(&scheduler.finalFailed)
+}
+
+func (scheduler *Scheduler) GetLimitKilled() int64 {
+	return atomic.LoadInt64(&scheduler.limitKilled)
+}
+
+func (scheduler *Scheduler) GetExitStats() task.ExitStats {
+	scheduler.exitsMutex.Lock()
+	defer scheduler.exitsMutex.Unlock()
+	return scheduler.exits
 }
 
-func (scheduler *Scheduler) SetTasks(tasks []TaskSettings) {
-	scheduler.setChan <- SetScheduleCommand{tasks: tasks}
+func (scheduler *Scheduler) SetTasks(tasks []TaskSettings, groups map[string]group.Settings) {
+	select {
+	case scheduler.setChan <- SetScheduleCommand{tasks: tasks, groups: groups}:
+	case <-scheduler.finished:
+	}
 }
 
 func (scheduler *Scheduler) RunTask(id uuid.UUID) {
-	scheduler.runChan <- RunTaskCommand{id: id}
+	select {
+	case scheduler.runChan <- RunTaskCommand{id: id}:
+	case <-scheduler.finished:
+	}
 }
 
-func (scheduler *Scheduler) Stop(onstop func()) {
-	scheduler.stopChan <- StopCommand{onstop: onstop}
+// Stop stops triggers, waits running tasks for the drain time, then interrupts them.
+// It returns the context error if the tasks are not finished when the context is done, they are left running.
+func (scheduler *Scheduler) Stop(ctx context.Context) error {
+	select {
+	case scheduler.stopChan <- StopCommand{}:
+	case <-scheduler.finished:
+		return nil
+	}
+	select {
+	case <-scheduler.finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done is closed when the scheduler is stopped, getters return empty values then
+func (scheduler *Scheduler) Done() <-chan struct{} {
+	return scheduler.finished
 }
 
-func (scheduler *Scheduler) setTasks(tasks []TaskSettings) {
+// Ping returns whether the main loop responds within the timeout
+func (scheduler *Scheduler) Ping(timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	response := make(chan bool, 1)
+	select {
+	case scheduler.pingChan <- PingCommand{response: response}:
+	case <-deadline:
+		return false
+	}
+	select {
+	case <-response:
+		return true
+	case <-deadline:
+		return false
+	}
+}
+
+// StopTriggers stops cron triggers and cancels delayed and queued runs, running tasks keep running
+func (scheduler *Scheduler) StopTriggers(ctx context.Context) error {
+	response := make(chan bool, 1)
+	select {
+	case scheduler.stopTriggersChan <- StopTriggersCommand{response: response}:
+	case <-scheduler.finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-response:
+	case <-scheduler.finished:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (scheduler *Scheduler) stopTriggers() {
+	if scheduler.exit {
+		return
+	}
+	scheduler.logger.Info("Scheduler stop triggers")
+	scheduler.exit = true
 	if scheduler.cron != nil {
 		scheduler.cron.Stop()
 	}
-	log.Info("Set scheduler tasks")
-	scheduler.cron = cron.New()
+	for _, cronTask := range scheduler.schedule {
+		for _, run := range cronTask.cancelDelayed(scheduler.clock.Now()) {
+			scheduler.complete(cronTask, run)
+		}
+	}
+	scheduler.cancelQueued(nil)
+}
+
+func (scheduler *Scheduler) cancelRunning() {
+	for _, cronTask := range scheduler.schedule {
+		cronTask.Task.Cancel()
+	}
+}
+
+func (scheduler *Scheduler) setTasks(tasks []TaskSettings, groups map[string]group.Settings) {
+	if scheduler.cron != nil {
+		scheduler.cron.Stop()
+	}
+	scheduler.logger.Info("Set scheduler tasks")
+	scheduler.cron = clock.NewCron(scheduler.clock)
+	g, err := newGraph(tasks)
+	if err != nil {
+		scheduler.logger.Error("Fail set tasks dependencies: %v", err)
+		g, _ = newGraph(nil)
+	}
+	scheduler.graph = g
+	if groups == nil {
+		groups = map[string]group.Settings{}
+	}
+	scheduler.groups = groups
 	var schedule []*CronTask
 	for _, set := range tasks {
-		cronTask := findCronTask(scheduler.schedule, set.Cron, set.Cmd)
-		if cronTask == nil {
-			t := task.New(set.Cmd, scheduler.taskNotifications)
+		location, err := scheduler.location(set.Timezone)
+		if err != nil {
+			scheduler.logger.Error("Fail load timezone for task: %v, error: %v", set, err)
+			continue
+		}
+		cronTask := findCronTask(scheduler.schedule, set)
+		added := cronTask == nil
+		if added {
+			options, err := set.SpawnSettings.Options()
+			if err != nil {
+				scheduler.logger.Error("Fail prepare task: %v, error: %v", set, err)
+				continue
+			}
+			options.Runner = scheduler.options.Runner
+			options.Registry = scheduler.options.Registry
+			options.Clock = scheduler.clock
+			options.Logger = scheduler.logger
 			cronTask = &CronTask{
 				Settings: set,
-				Task:     &t,
+				Task:     task.New(set.Cmd, options, scheduler.taskNotifications),
+				Location: location,
 			}
-			log.Info("Add task: %v", set)
+			scheduler.logger.Info("Add task: %v", set)
 		} else {
-			log.Debug("Task has not changed: %v", set)
+			cronTask.Settings = set
+			scheduler.logger.Debug("Task has not changed: %v", set)
+		}
+		if set.Spread {
+			cronTask.delay = scheduler.delay(cronTask)
 		}
 		schedule = append(schedule, cronTask)
 		if set.Cron != "manual" {
-			err := scheduler.cron.AddJob(set.Cron, *cronTask)
+			zoned, err := clock.NewZonedSchedule(set.Cron, location)
 			if err != nil {
-				log.Error("Fail pass task to cron: %v, error: %v", set, err)
+				scheduler.logger.Error("Fail pass task to cron: %v, error: %v", set, err)
+				continue
+			}
+			scheduler.cron.Schedule(zoned, cronJob{cronTask.Task, scheduler.triggerChan, scheduler.finished})
+			if added {
+				scheduler.catchup(cronTask, zoned)
 			}
 		}
 	}
 	for _, tsk := range scheduler.schedule {
-		if findCronTask(schedule, tsk.Settings.Cron, tsk.Settings.Cmd) == nil {
-			log.Info("Remove task: %v", tsk.Settings)
+		if findCronTask(schedule, tsk.Settings) == nil {
+			scheduler.logger.Info("Remove task: %v", tsk.Settings)
+			for _, run := range tsk.cancelDelayed(scheduler.clock.Now()) {
+				scheduler.complete(tsk, run)
+			}
+			scheduler.cancelQueued(tsk)
 			tsk.Task.Cancel()
 		}
 	}
 	scheduler.schedule = schedule
 	scheduler.cron.Start()
+	scheduler.dequeue()
+}
+
+func (scheduler *Scheduler) catchup(cronTask *CronTask, zoned *clock.ZonedSchedule) {
+	if !cronTask.hasCatchup() {
+		return
+	}
+	name := cronTask.Settings.GetName()
+	if scheduler.options.StateFile == "" {
+		scheduler.logger.Warning("Task %v has catchup %v but no state file is set, missed runs are not caught up", name, cronTask.Settings.Catchup)
+		return
+	}
+	now := scheduler.clock.Now()
+	missed := missedFires(cronTask.Settings, zoned, scheduler.state.LastFire[name], now)
+	for _, fire := range missed {
+		scheduler.logger.Info("Catch up task %v missed at %v", name, fire)
+		scheduler.trigger(cronTask, TriggerCatchup, fire, 0)
+	}
+	scheduler.state.setLastFire(name, now)
+}
+
+func (scheduler *Scheduler) trigger(cronTask *CronTask, trigger string, scheduled time.Time, delay time.Duration) {
+	run := &RunRecord{
+		Id:        uuid.New(),
+		Trigger:   trigger,
+		Scheduled: scheduled,
+		Delay:     task.Duration(delay),
+	}
+	if delay > 0 {
+		cronTask.delay = delay
+	}
+	name := cronTask.Settings.GetName()
+	if wf, root := scheduler.waitingWorkflow(name); wf != nil {
+		root.Status = StepRunning
+		root.Run = &run.Id
+		run.Workflow = &wf.Id
+		scheduler.logger.Info("Workflow %v continue from task %v", wf.Id, name)
+	} else if scheduler.graph.hasNext(name) {
+		wf := newWorkflow(scheduler.graph, name, scheduler.clock.Now())
+		root := wf.step(name)
+		root.Status = StepRunning
+		root.Run = &run.Id
+		run.Workflow = &wf.Id
+		scheduler.workflows = append(scheduler.workflows, wf)
+		scheduler.workflows = trimWorkflows(scheduler.workflows, workflowsLimit)
+		scheduler.logger.Info("Start workflow %v from task %v", wf.Id, name)
+	}
+	scheduler.submit(cronTask, run)
+}
+
+// submit adds the run to the task history and launches it after the run delay
+func (scheduler *Scheduler) submit(cronTask *CronTask, run *RunRecord) {
+	run.Status = RunDelayed
+	cronTask.history.add(run)
+	delay := run.Delay.Duration()
+	if delay <= 0 {
+		scheduler.launch(cronTask, run)
+		return
+	}
+	scheduler.logger.Debug("Delay task %v run %v for %v", cronTask.Settings.GetName(), run.Id, delay)
+	run.timer = scheduler.clock.AfterFunc(delay, func() {
+		select {
+		case scheduler.launchChan <- LaunchCommand{cronTask, run}:
+		case <-scheduler.finished:
+		}
+	})
+}
+
+// complete accounts a finished run, retries it on failure and advances its workflow
+func (scheduler *Scheduler) complete(cronTask *CronTask, run *RunRecord) {
+	if run.isFailed() && !scheduler.exit && shouldRetry(cronTask.Settings, run) {
+		atomic.AddInt64(&scheduler.retried, 1)
+		cronTask.Stats.Retried += 1
+		root := run.Id
+		if run.RetryOf != nil {
+			root = *run.RetryOf
+		}
+		attempt := run.Attempt + 1
+		retry := &RunRecord{
+			Id:        uuid.New(),
+			Trigger:   TriggerRetry,
+			Scheduled: scheduler.clock.Now(),
+			Delay:     task.Duration(retryDelay(cronTask.Settings, attempt)),
+			Attempt:   attempt,
+			RetryOf:   &root,
+			Workflow:  run.Workflow,
+		}
+		scheduler.logger.Info("Retry task %v run %v, attempt %d of %d", cronTask.Settings.GetName(), root, attempt, cronTask.Settings.Retries)
+		if wf := scheduler.findWorkflow(run.Workflow); wf != nil {
+			if step := wf.step(cronTask.Settings.GetName()); step != nil {
+				step.Run = &retry.Id
+			}
+		}
+		scheduler.submit(cronTask, retry)
+		return
+	}
+	if run.isFailed() {
+		atomic.AddInt64(&scheduler.finalFailed, 1)
+		cronTask.Stats.FinalFailed += 1
+	}
+	if wf := scheduler.findWorkflow(run.Workflow); wf != nil {
+		scheduler.advance(wf, cronTask.Settings.GetName(), run.isSucceeded())
+	}
+}
+
+// waitingWorkflow returns the oldest running workflow waiting for the root task
+func (scheduler *Scheduler) waitingWorkflow(name string) (*Workflow, *WorkflowStep) {
+	for _, wf := range scheduler.workflows {
+		if wf.Status != WorkflowRunning {
+			continue
+		}
+		if step := wf.step(name); step != nil && step.Status == StepWaiting {
+			return wf, step
+		}
+	}
+	return nil, nil
+}
+
+func (scheduler *Scheduler) findWorkflow(id *uuid.UUID) *Workflow {
+	if id == nil {
+		return nil
+	}
+	for _, wf := range scheduler.workflows {
+		if wf.Id == *id {
+			return wf
+		}
+	}
+	return nil
+}
+
+// advance resolves the workflow step and starts the steps depending on it
+func (scheduler *Scheduler) advance(wf *Workflow, name string, succeeded bool) {
+	step := wf.step(name)
+	if step == nil || step.Status != StepRunning {
+		return
+	}
+	if succeeded {
+		step.Status = StepSucceeded
+	} else {
+		step.Status = StepFailed
+	}
+	for skipped := true; skipped; {
+		skipped = false
+		for _, next := range wf.ready(scheduler.graph, scheduler.clock.Now()) {
+			cronTask := findCronTaskByName(scheduler.schedule, next.Task)
+			if cronTask == nil || scheduler.exit {
+				next.Status = StepSkipped
+				skipped = true
+				continue
+			}
+			run := &RunRecord{
+				Id:        uuid.New(),
+				Trigger:   TriggerDependency,
+				Scheduled: scheduler.clock.Now(),
+				Workflow:  &wf.Id,
+			}
+			next.Run = &run.Id
+			scheduler.logger.Info("Workflow %v start task %v", wf.Id, next.Task)
+			scheduler.submit(cronTask, run)
+		}
+	}
+	wf.updateStatus(scheduler.clock.Now())
+	if wf.Finished != nil {
+		scheduler.logger.Info("Workflow %v %s", wf.Id, wf.Status)
+	}
+}
+
+func (scheduler *Scheduler) watchTimeout(cronTask *CronTask, run *RunRecord) {
+	timeout := cronTask.Settings.Timeout.Duration()
+	if timeout <= 0 {
+		return
+	}
+	run.timeout = scheduler.clock.AfterFunc(timeout, func() {
+		select {
+		case scheduler.timeoutChan <- TimeoutCommand{cronTask, run}:
+		case <-scheduler.finished:
+		}
+	})
+}
+
+func (scheduler *Scheduler) location(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return scheduler.options.Location, nil
+	}
+	return time.LoadLocation(timezone)
 }
 
-func findCronTask(schedule []*CronTask, cron string, cmd string) *CronTask {
+func findCronTask(schedule []*CronTask, set TaskSettings) *CronTask {
 	for _, cronTask := range schedule {
-		if cronTask.Settings.Cron == cron && cronTask.Settings.Cmd == cmd {
+		if cronTask.Settings.Cron == set.Cron && cronTask.Settings.Cmd == set.Cmd && cronTask.Settings.Timezone == set.Timezone &&
+			reflect.DeepEqual(cronTask.Settings.SpawnSettings, set.SpawnSettings) {
+			return cronTask
+		}
+	}
+	return nil
+}
+
+func findCronTaskByName(schedule []*CronTask, name string) *CronTask {
+	for _, cronTask := range schedule {
+		if cronTask.Settings.GetName() == name {
 			return cronTask
 		}
 	}
@@ -208,17 +780,104 @@ func findCronTaskByUUID(schedule []*CronTask, id uuid.UUID) *CronTask {
 }
 
 func (scheduler *Scheduler) getInfo() []TaskInfo {
+	var entries []clock.Entry
+	if scheduler.cron != nil {
+		entries = scheduler.cron.Entries()
+	}
 	var info []TaskInfo
 	for _, tsk := range scheduler.schedule {
-		info = append(info, tsk.getInfo())
+		var prev, next time.Time
+		for _, entry := range entries {
+			if job, ok := entry.Job.(cronJob); ok && job.task == tsk.Task {
+				prev, next = entry.Prev, entry.Next
+				break
+			}
+		}
+		info = append(info, tsk.getInfo(prev, next))
 	}
 	return info
 }
 
+func (scheduler *Scheduler) getWorkflows() []Workflow {
+	list := make([]Workflow, 0, len(scheduler.workflows))
+	for _, wf := range scheduler.workflows {
+		list = append(list, wf.copy())
+	}
+	return list
+}
+
+func (scheduler *Scheduler) GetWorkflows() []Workflow {
+	response := make(chan []Workflow, 1)
+	select {
+	case scheduler.getWorkflowsChan <- GetWorkflowsCommand{response: response}:
+	case <-scheduler.finished:
+		return nil
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-scheduler.finished:
+		return nil
+	}
+}
+
+func (scheduler *Scheduler) GetGroups() []GroupInfo {
+	response := make(chan []GroupInfo, 1)
+	select {
+	case scheduler.getGroupsChan <- GetGroupsCommand{response: response}:
+	case <-scheduler.finished:
+		return nil
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-scheduler.finished:
+		return nil
+	}
+}
+
+func (scheduler *Scheduler) GetQueue() []QueueInfo {
+	response := make(chan []QueueInfo, 1)
+	select {
+	case scheduler.getQueueChan <- GetQueueCommand{response: response}:
+	case <-scheduler.finished:
+		return nil
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-scheduler.finished:
+		return nil
+	}
+}
+
+// CancelQueued drops the queued run, returns false if the run is not in the queue
+func (scheduler *Scheduler) CancelQueued(id uuid.UUID) bool {
+	response := make(chan bool, 1)
+	select {
+	case scheduler.cancelQueuedChan <- CancelQueuedCommand{id: id, response: response}:
+	case <-scheduler.finished:
+		return false
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-scheduler.finished:
+		return false
+	}
+}
+
 func (scheduler *Scheduler) GetInfo() []TaskInfo {
 	response := make(chan []TaskInfo, 1)
-	scheduler.getInfoChan <- GetInfoCommand{
-		response: response,
+	select {
+	case scheduler.getInfoChan <- GetInfoCommand{response: response}:
+	case <-scheduler.finished:
+		return nil
+	}
+	select {
+	case result := <-response:
+		return result
+	case <-scheduler.finished:
+		return nil
 	}
-	return <-response
 }
@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentRunStopAndScrape(t *testing.T) {
+	scheduler := New(Options{Hostname: "test"})
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = scheduler.GetDone()
+					_ = scheduler.GetRunning()
+					_ = scheduler.GetFailed()
+					_ = scheduler.GetErrors()
+					_ = scheduler.GetRetried()
+					_ = scheduler.GetFinalFailed()
+					_ = scheduler.GetLimitKilled()
+					_ = scheduler.GetExitStats()
+				}
+			}
+		}()
+	}
+
+	scheduler.SetTasks([]TaskSettings{
+		{Name: "ok", Cron: "* * * * * *", Cmd: "sleep 0.1"},
+		{Name: "fail", Cron: "* * * * * *", Cmd: "sh -c 'exit 1'"},
+		{Name: "long", Cron: "* * * * * *", Cmd: "sleep 10"},
+	}, nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (scheduler.GetDone() < 2 || scheduler.GetErrors() < 1) && time.Now().Before(deadline) {
+		_ = scheduler.GetInfo()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if scheduler.GetErrors() < 1 {
+		t.Errorf("errors %d, want failed runs", scheduler.GetErrors())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := scheduler.Stop(ctx); err != nil {
+		t.Fatalf("scheduler is not stopped: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if running := scheduler.GetRunning(); running != 0 {
+		t.Errorf("running %d after stop, want 0", running)
+	}
+}
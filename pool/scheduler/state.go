@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"github.com/stepan-s/jobro/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Persistent scheduler state, survives restarts
+type state struct {
+	path     string
+	logger   *log.Logger
+	LastFire map[string]time.Time `json:"last_fire"`
+}
+
+func loadState(path string, logger *log.Logger) *state {
+	st := &state{
+		path:     path,
+		logger:   logger,
+		LastFire: map[string]time.Time{},
+	}
+	if path == "" {
+		return st
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Fail read scheduler state %v, error: %v", path, err)
+		}
+		return st
+	}
+	err = json.Unmarshal(data, st)
+	if err != nil {
+		logger.Error("Fail parse scheduler state %v, error: %v", path, err)
+	}
+	if st.LastFire == nil {
+		st.LastFire = map[string]time.Time{}
+	}
+	return st
+}
+
+func (st *state) setLastFire(name string, t time.Time) {
+	st.LastFire[name] = t
+	st.save()
+}
+
+func (st *state) save() {
+	if st.path == "" {
+		return
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		st.logger.Error("Fail prepare scheduler state: %v", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(st.path), filepath.Base(st.path)+".*")
+	if err != nil {
+		st.logger.Error("Fail save scheduler state %v, error: %v", st.path, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), st.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		st.logger.Error("Fail save scheduler state %v, error: %v", st.path, err)
+	}
+}
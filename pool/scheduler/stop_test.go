@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/pool/task"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStopDrainsThenInterrupts(t *testing.T) {
+	s := newTestSchedulerWith(t, Options{Drain: 30 * time.Second}, []TaskSettings{
+		{Name: "a", Cron: "0 * * * * *", Cmd: "a"},
+	}, nil)
+	s.clock.Advance(time.Minute)
+	process := s.waitRunning(1)[0]
+
+	// Triggers are stopped first, then the drain timer is the only one
+	_ = s.StopTriggers(context.Background())
+	done := s.stop()
+	s.eventually("drain timer", func() bool {
+		return s.clock.Timers() == 1
+	})
+	s.clock.Advance(29 * time.Second)
+	if len(process.Signals()) != 0 {
+		t.Fatalf("interrupted while draining")
+	}
+	if isClosed(done) {
+		t.Fatalf("stopped while a task is running")
+	}
+
+	s.clock.Advance(time.Second)
+	s.eventually("stop", func() bool {
+		return isClosed(done)
+	})
+	if signals := process.Signals(); len(signals) != 1 || signals[0] != syscall.SIGINT {
+		t.Errorf("signals %v, want SIGINT", signals)
+	}
+	s.clock.Advance(time.Hour)
+	if len(s.runner.Processes()) != 1 {
+		t.Errorf("task triggered after stop")
+	}
+}
+
+func TestStopFinishesWhenDrained(t *testing.T) {
+	s := newTestSchedulerWith(t, Options{Drain: time.Minute}, []TaskSettings{{Name: "a", Cron: "manual", Cmd: "a"}}, nil)
+	s.run("a")
+	process := s.waitRunning(1)[0]
+
+	done := s.stop()
+	_ = process.Exit(0)
+	s.eventually("stop", func() bool {
+		return isClosed(done)
+	})
+	if len(process.Signals()) != 0 {
+		t.Errorf("drained task was interrupted")
+	}
+}
+
+func TestStopTriggersKeepsRunning(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{
+		{Name: "a", Cron: "*/10 * * * * *", Cmd: "a"},
+	}, nil)
+	s.clock.Advance(10 * time.Second)
+	process := s.waitRunning(1)[0]
+
+	if err := s.StopTriggers(context.Background()); err != nil {
+		t.Fatalf("stop triggers error: %v", err)
+	}
+	s.clock.Advance(time.Minute)
+	if len(s.runner.Processes()) != 1 || process.Exited() {
+		t.Errorf("triggers are not stopped or the task is interrupted")
+	}
+
+	done := s.stop()
+	s.eventually("stop", func() bool {
+		return isClosed(done)
+	})
+	if !process.Exited() {
+		t.Errorf("task is not interrupted on stop without drain")
+	}
+}
+
+func TestStopTimeoutKills(t *testing.T) {
+	set := TaskSettings{Name: "a", Cron: "manual", Cmd: "a"}
+	set.StopSignal = "TERM"
+	set.StopTimeout = task.Duration(5 * time.Second)
+	s := newTestScheduler(t, []TaskSettings{set}, nil)
+	s.runner.Ignore[syscall.SIGTERM] = true
+	s.run("a")
+	process := s.waitRunning(1)[0]
+
+	done := s.stop()
+	s.eventually("stop signal", func() bool {
+		return len(process.Signals()) == 1
+	})
+	s.sync()
+	s.clock.Advance(5 * time.Second)
+	s.eventually("stop", func() bool {
+		return isClosed(done)
+	})
+	if signals := process.Signals(); len(signals) != 2 || signals[0] != syscall.SIGTERM || signals[1] != syscall.SIGKILL {
+		t.Errorf("signals %v, want SIGTERM and SIGKILL", signals)
+	}
+}
+
+func TestStopContextDoneLeavesTasks(t *testing.T) {
+	s := newTestSchedulerWith(t, Options{Drain: time.Minute}, []TaskSettings{{Name: "a", Cron: "manual", Cmd: "a"}}, nil)
+	s.run("a")
+	process := s.waitRunning(1)[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Stop(ctx); err != context.Canceled {
+		t.Errorf("stop error %v, want canceled", err)
+	}
+	if process.Exited() {
+		t.Fatalf("interrupted before the drain timeout")
+	}
+
+	// A repeated stop does not wait the drain
+	done := s.stop()
+	s.eventually("stop", func() bool {
+		return isClosed(done)
+	})
+	if signals := process.Signals(); len(signals) != 1 || signals[0] != syscall.SIGINT {
+		t.Errorf("signals %v, want SIGINT", signals)
+	}
+}
+
+func TestGettersAfterStop(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{{Name: "a", Cron: "manual", Cmd: "a"}}, nil)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop error: %v", err)
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Fatalf("done is not closed")
+	}
+	if s.GetInfo() != nil || s.GetGroups() != nil || s.GetQueue() != nil || s.GetWorkflows() != nil {
+		t.Errorf("stopped scheduler returns the state")
+	}
+	s.RunTask(uuid.New())
+	s.SetTasks(nil, nil)
+	if err := s.StopTriggers(context.Background()); err != nil {
+		t.Errorf("stop triggers error: %v", err)
+	}
+}
@@ -3,43 +3,117 @@ package scheduler
 import (
 	"github.com/google/uuid"
 	"github.com/stepan-s/jobro/pool/task"
+	"time"
 )
 
 type TaskSettings struct {
-	Cron  string `json:"cron"`
-	Cmd   string `json:"cmd"`
-	Group string `json:"group"`
+	Name     string        `json:"name"`
+	Cron     string        `json:"cron"`
+	Cmd      string        `json:"cmd"`
+	Group    string        `json:"group"`
+	Timezone string        `json:"timezone"`
+	Jitter   task.Duration `json:"jitter"`
+	Spread   bool          `json:"spread"`
+	// Catch-up policy for fires missed while jobro was down: none, once or all
+	Catchup          string        `json:"catchup"`
+	CatchupLimit     int           `json:"catchup_limit"`
+	StartingDeadline task.Duration `json:"starting_deadline"`
+	// Interrupt a run after the timeout
+	Timeout task.Duration `json:"timeout"`
+	// Retry failed runs
+	Retries       int           `json:"retries"`
+	RetryBackoff  string        `json:"retry_backoff"`
+	RetryDelay    task.Duration `json:"retry_delay"`
+	RetryMaxDelay task.Duration `json:"retry_max_delay"`
+	RetryOn       RetryOn       `json:"retry_on"`
+	// Dependencies by task names
+	After     []string `json:"after"`
+	OnSuccess []string `json:"on_success"`
+	OnFailure []string `json:"on_failure"`
+	// Queued runs with higher priority start first
+	Priority int `json:"priority"`
+	task.SpawnSettings
+}
+
+// GetName returns the task name, the command is used when name is not set
+func (settings TaskSettings) GetName() string {
+	if settings.Name != "" {
+		return settings.Name
+	}
+	return settings.Cmd
 }
 
 type TaskStats struct {
-	Done    int64 `json:"done"`
-	Running int64 `json:"running"`
-	Failed  int64 `json:"failed"`
-	Errors  int64 `json:"errors"`
+	Done        int64 `json:"done"`
+	Running     int64 `json:"running"`
+	Failed      int64 `json:"failed"`
+	Errors      int64 `json:"errors"`
+	Retried     int64 `json:"retried"`
+	FinalFailed int64 `json:"final_failed"`
+	LimitKilled int64 `json:"limit_killed"`
+	task.ExitStats
 }
 
 type TaskInfo struct {
-	Id       uuid.UUID    `json:"id"`
-	Settings TaskSettings `json:"settings"`
-	Stats    TaskStats    `json:"stats"`
-	Pids     []int        `json:"pids"`
+	Id       uuid.UUID     `json:"id"`
+	Settings TaskSettings  `json:"settings"`
+	Stats    TaskStats     `json:"stats"`
+	Pids     []int         `json:"pids"`
+	Timezone string        `json:"timezone"`
+	PrevRun  *FireTime     `json:"prev_run"`
+	NextRun  *FireTime     `json:"next_run"`
+	Delay    task.Duration `json:"delay"`
+	History  []RunRecord   `json:"history"`
 }
 
 type CronTask struct {
 	Settings TaskSettings
 	Stats    TaskStats
 	Task     *task.Task
+	Location *time.Location
+	delay    time.Duration
+	history  history
 }
 
-func (cronTask CronTask) Run() {
-	go cronTask.Task.Exec("scheduled")
+// cronJob is passed to cron, it only forwards triggers to the scheduler main loop
+type cronJob struct {
+	task     *task.Task
+	trigger  chan TriggerCommand
+	finished chan struct{}
+}
+
+func (job cronJob) Run() {
+	select {
+	case job.trigger <- TriggerCommand{id: job.task.GetId()}:
+	case <-job.finished:
+	}
+}
+
+func (cronTask *CronTask) hasCatchup() bool {
+	return cronTask.Settings.Catchup != "" && cronTask.Settings.Catchup != CatchupNone
+}
+
+func (cronTask *CronTask) cancelDelayed(now time.Time) []*RunRecord {
+	var cancelled []*RunRecord
+	for _, run := range cronTask.history.runs {
+		if run.Status == RunDelayed && run.timer.Stop() {
+			run.finish(RunCancelled, now)
+			cancelled = append(cancelled, run)
+		}
+	}
+	return cancelled
 }
 
-func (cronTask CronTask) getInfo() TaskInfo {
+func (cronTask *CronTask) getInfo(prev time.Time, next time.Time) TaskInfo {
 	return TaskInfo{
 		Id:       cronTask.Task.GetId(),
 		Settings: cronTask.Settings,
 		Stats:    cronTask.Stats,
 		Pids:     cronTask.Task.GetPids(),
+		Timezone: cronTask.Location.String(),
+		PrevRun:  newFireTime(prev, cronTask.Location),
+		NextRun:  newFireTime(next, cronTask.Location),
+		Delay:    task.Duration(cronTask.delay),
+		History:  cronTask.history.list(),
 	}
 }
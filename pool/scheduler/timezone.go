@@ -0,0 +1,20 @@
+package scheduler
+
+import (
+	"time"
+)
+
+type FireTime struct {
+	UTC   time.Time `json:"utc"`
+	Local time.Time `json:"local"`
+}
+
+func newFireTime(t time.Time, location *time.Location) *FireTime {
+	if t.IsZero() {
+		return nil
+	}
+	return &FireTime{
+		UTC:   t.UTC(),
+		Local: t.In(location),
+	}
+}
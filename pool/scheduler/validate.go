@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/stepan-s/jobro/clock"
+	"time"
+)
+
+// Validate checks the tasks settings before applying
+func Validate(tasks []TaskSettings) error {
+	for _, set := range tasks {
+		location := time.UTC
+		if set.Timezone != "" {
+			var err error
+			if location, err = time.LoadLocation(set.Timezone); err != nil {
+				return fmt.Errorf("task %v: %v", set.GetName(), err)
+			}
+		}
+		if set.Cron != "manual" {
+			if _, err := clock.NewZonedSchedule(set.Cron, location); err != nil {
+				return fmt.Errorf("task %v: cron %q: %v", set.GetName(), set.Cron, err)
+			}
+		}
+		switch set.Catchup {
+		case "", CatchupNone, CatchupOnce, CatchupAll:
+		default:
+			return fmt.Errorf("task %v: unknown catchup %q", set.GetName(), set.Catchup)
+		}
+		switch set.RetryBackoff {
+		case "", BackoffFixed, BackoffExponential:
+		default:
+			return fmt.Errorf("task %v: unknown retry_backoff %q", set.GetName(), set.RetryBackoff)
+		}
+		if _, err := set.SpawnSettings.Options(); err != nil {
+			return fmt.Errorf("task %v: %v", set.GetName(), err)
+		}
+	}
+	_, err := newGraph(tasks)
+	return err
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"github.com/stepan-s/jobro/pool/task"
+	"testing"
+)
+
+func TestValidateCron(t *testing.T) {
+	cases := []struct {
+		name string
+		set  TaskSettings
+		err  bool
+	}{
+		{"seconds", TaskSettings{Cmd: "a", Cron: "0 */5 * * * *"}, false},
+		{"descriptor", TaskSettings{Cmd: "a", Cron: "@hourly"}, false},
+		{"manual", TaskSettings{Cmd: "a", Cron: "manual"}, false},
+		{"timezone", TaskSettings{Cmd: "a", Cron: "0 0 3 * * *", Timezone: "Europe/Berlin"}, false},
+		{"empty", TaskSettings{Cmd: "a"}, true},
+		{"garbage", TaskSettings{Cmd: "a", Cron: "every minute"}, true},
+		{"out of range", TaskSettings{Cmd: "a", Cron: "61 * * * * *"}, true},
+	}
+	for _, c := range cases {
+		err := Validate([]TaskSettings{c.set})
+		if (err != nil) != c.err {
+			t.Errorf("%v: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestValidateRetryBackoff(t *testing.T) {
+	for backoff, valid := range map[string]bool{"": true, BackoffFixed: true, BackoffExponential: true, "linear": false, "Fixed": false} {
+		err := Validate([]TaskSettings{{Cmd: "a", Cron: "manual", RetryBackoff: backoff}})
+		if (err == nil) != valid {
+			t.Errorf("retry_backoff %q: unexpected error %v", backoff, err)
+		}
+	}
+}
+
+func TestValidateCatchup(t *testing.T) {
+	for catchup, valid := range map[string]bool{"": true, CatchupNone: true, CatchupOnce: true, CatchupAll: true, "last": false, "yes": false} {
+		err := Validate([]TaskSettings{{Cmd: "a", Cron: "0 0 * * * *", Catchup: catchup}})
+		if (err == nil) != valid {
+			t.Errorf("catchup %q: unexpected error %v", catchup, err)
+		}
+	}
+}
+
+func TestTaskSettingsUserAndGroups(t *testing.T) {
+	var set TaskSettings
+	err := json.Unmarshal([]byte(`{"cmd": "a", "cron": "manual", "group": "heavy", "user": "1234", "user_group": "2345", "supplementary_groups": ["3456"]}`), &set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Group != "heavy" {
+		t.Errorf("concurrency group is %q, want heavy", set.Group)
+	}
+	options, err := set.SpawnSettings.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential := options.Credential
+	if credential == nil || credential.Uid != 1234 || credential.Gid != 2345 || len(credential.Groups) != 1 || credential.Groups[0] != 3456 {
+		t.Errorf("credential %+v, want user 1234, group 2345 and groups [3456]", credential)
+	}
+	if err := Validate([]TaskSettings{{Cmd: "a", Cron: "manual", SpawnSettings: task.SpawnSettings{User: "no-such-user"}}}); err == nil {
+		t.Errorf("unknown user is accepted")
+	}
+}
@@ -0,0 +1,319 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+// How many workflows to keep
+const workflowsLimit = 50
+
+const StepPending = "pending"
+const StepWaiting = "waiting"
+const StepRunning = "running"
+const StepSucceeded = "succeeded"
+const StepFailed = "failed"
+const StepSkipped = "skipped"
+
+const WorkflowRunning = "running"
+const WorkflowSucceeded = "succeeded"
+const WorkflowFailed = "failed"
+
+// Dependencies between tasks, by task name
+type graph struct {
+	success map[string][]string
+	failure map[string][]string
+}
+
+func newGraph(tasks []TaskSettings) (*graph, error) {
+	g := &graph{
+		success: map[string][]string{},
+		failure: map[string][]string{},
+	}
+	names := map[string]bool{}
+	for _, set := range tasks {
+		if names[set.GetName()] {
+			return nil, fmt.Errorf("duplicate task name: %v", set.GetName())
+		}
+		names[set.GetName()] = true
+	}
+	link := func(edges map[string][]string, from string, to string) error {
+		if !names[from] {
+			return fmt.Errorf("unknown task %v in dependencies of %v", from, to)
+		}
+		if !names[to] {
+			return fmt.Errorf("unknown task %v in dependencies of %v", to, from)
+		}
+		for _, exist := range edges[from] {
+			if exist == to {
+				return nil
+			}
+		}
+		edges[from] = append(edges[from], to)
+		return nil
+	}
+	for _, set := range tasks {
+		name := set.GetName()
+		for _, before := range set.After {
+			if err := link(g.success, before, name); err != nil {
+				return nil, err
+			}
+		}
+		for _, next := range set.OnSuccess {
+			if err := link(g.success, name, next); err != nil {
+				return nil, err
+			}
+		}
+		for _, next := range set.OnFailure {
+			if err := link(g.failure, name, next); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cycle := g.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("dependency cycle: %v", cycle)
+	}
+	return g, nil
+}
+
+func (g *graph) next(name string) []string {
+	return append(append([]string{}, g.success[name]...), g.failure[name]...)
+}
+
+func (g *graph) hasNext(name string) bool {
+	return len(g.success[name]) > 0 || len(g.failure[name]) > 0
+}
+
+func (g *graph) previous(name string) []string {
+	var list []string
+	for _, edges := range []map[string][]string{g.success, g.failure} {
+		for from, targets := range edges {
+			for _, to := range targets {
+				if to == name {
+					list = append(list, from)
+				}
+			}
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (g *graph) findCycle() []string {
+	const visiting = 1
+	const visited = 2
+	marks := map[string]int{}
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch marks[name] {
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		path = append(path, name)
+		for _, next := range g.next(name) {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		marks[name] = visited
+		return nil
+	}
+	var roots []string
+	for name := range g.success {
+		roots = append(roots, name)
+	}
+	for name := range g.failure {
+		roots = append(roots, name)
+	}
+	for _, name := range roots {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+type WorkflowStep struct {
+	Task   string     `json:"task"`
+	Status string     `json:"status"`
+	Run    *uuid.UUID `json:"run,omitempty"`
+}
+
+type Workflow struct {
+	Id       uuid.UUID       `json:"id"`
+	Root     string          `json:"root"`
+	Status   string          `json:"status"`
+	Started  time.Time       `json:"started"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Steps    []*WorkflowStep `json:"steps"`
+}
+
+// newWorkflow builds the workflow over all tasks connected with the root, so a task after several
+// independent roots joins them in one workflow. Other roots wait for their own trigger.
+func newWorkflow(g *graph, root string, now time.Time) *Workflow {
+	wf := &Workflow{
+		Id:      uuid.New(),
+		Root:    root,
+		Status:  WorkflowRunning,
+		Started: now,
+	}
+	queue := []string{root}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if wf.step(name) != nil {
+			continue
+		}
+		previous := g.previous(name)
+		status := StepPending
+		if name != root && len(previous) == 0 {
+			status = StepWaiting
+		}
+		wf.Steps = append(wf.Steps, &WorkflowStep{Task: name, Status: status})
+		queue = append(append(queue, g.next(name)...), previous...)
+	}
+	return wf
+}
+
+// trimWorkflows drops the oldest idle workflows above the limit, workflows with running steps are kept
+func trimWorkflows(list []*Workflow, limit int) []*Workflow {
+	excess := len(list) - limit
+	if excess <= 0 {
+		return list
+	}
+	kept := make([]*Workflow, 0, len(list))
+	for _, wf := range list {
+		if excess > 0 && !wf.isActive() {
+			excess -= 1
+			continue
+		}
+		kept = append(kept, wf)
+	}
+	return kept
+}
+
+// isActive returns whether the workflow has running steps
+func (wf *Workflow) isActive() bool {
+	if wf.Status != WorkflowRunning {
+		return false
+	}
+	for _, step := range wf.Steps {
+		if step.Status == StepRunning {
+			return true
+		}
+	}
+	return false
+}
+
+func (wf *Workflow) step(name string) *WorkflowStep {
+	for _, step := range wf.Steps {
+		if step.Task == name {
+			return step
+		}
+	}
+	return nil
+}
+
+func (wf *Workflow) copy() Workflow {
+	c := *wf
+	c.Steps = make([]*WorkflowStep, 0, len(wf.Steps))
+	for _, step := range wf.Steps {
+		s := *step
+		c.Steps = append(c.Steps, &s)
+	}
+	return c
+}
+
+func isResolved(status string) bool {
+	return status == StepSucceeded || status == StepFailed || status == StepSkipped
+}
+
+// ready returns pending steps to start and marks steps that can not start anymore as skipped
+func (wf *Workflow) ready(g *graph, now time.Time) []*WorkflowStep {
+	var start []*WorkflowStep
+	for changed := true; changed; {
+		changed = false
+		for _, step := range wf.Steps {
+			if step.Status == StepWaiting {
+				// Not needed anymore if all its dependents are resolved
+				needed := false
+				for _, next := range g.next(step.Task) {
+					if s := wf.step(next); s != nil && !isResolved(s.Status) {
+						needed = true
+					}
+				}
+				if !needed {
+					step.Status = StepSkipped
+					changed = true
+				}
+				continue
+			}
+			if step.Status != StepPending {
+				continue
+			}
+			successTotal, succeeded, successResolved := 0, 0, 0
+			failureTotal, failed, failureResolved := 0, 0, 0
+			for _, from := range wf.Steps {
+				for _, to := range g.success[from.Task] {
+					if to == step.Task {
+						successTotal += 1
+						if from.Status == StepSucceeded {
+							succeeded += 1
+						}
+						if isResolved(from.Status) {
+							successResolved += 1
+						}
+					}
+				}
+				for _, to := range g.failure[from.Task] {
+					if to == step.Task {
+						failureTotal += 1
+						if from.Status == StepFailed {
+							failed += 1
+						}
+						if isResolved(from.Status) {
+							failureResolved += 1
+						}
+					}
+				}
+			}
+			if (successTotal > 0 && succeeded == successTotal) || failed > 0 {
+				step.Status = StepRunning
+				start = append(start, step)
+				changed = true
+			} else if successResolved > succeeded || successTotal == 0 {
+				if failureResolved == failureTotal {
+					step.Status = StepSkipped
+					changed = true
+				}
+			}
+		}
+	}
+	wf.updateStatus(now)
+	return start
+}
+
+func (wf *Workflow) updateStatus(now time.Time) {
+	status := WorkflowSucceeded
+	for _, step := range wf.Steps {
+		if !isResolved(step.Status) {
+			return
+		}
+		if step.Status == StepFailed {
+			status = WorkflowFailed
+		}
+	}
+	wf.Status = status
+	wf.Finished = &now
+}
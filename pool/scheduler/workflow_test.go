@@ -0,0 +1,230 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrimWorkflowsKeepsRunning(t *testing.T) {
+	running := func() []*WorkflowStep {
+		return []*WorkflowStep{{Task: "a", Status: StepRunning}}
+	}
+	list := []*Workflow{
+		{Root: "a", Status: WorkflowRunning, Steps: running()},
+		{Root: "b", Status: WorkflowSucceeded},
+		{Root: "c", Status: WorkflowFailed},
+		{Root: "d", Status: WorkflowRunning, Steps: running()},
+		{Root: "e", Status: WorkflowSucceeded},
+		{Root: "f", Status: WorkflowRunning, Steps: []*WorkflowStep{{Task: "f", Status: StepWaiting}}},
+	}
+	roots := func(list []*Workflow) string {
+		result := ""
+		for _, wf := range list {
+			result += wf.Root
+		}
+		return result
+	}
+
+	if got := roots(trimWorkflows(list, 6)); got != "abcdef" {
+		t.Fatalf("expected nothing trimmed, got %v", got)
+	}
+	if got := roots(trimWorkflows(list, 5)); got != "acdef" {
+		t.Fatalf("expected oldest finished trimmed, got %v", got)
+	}
+	if got := roots(trimWorkflows(list, 3)); got != "adf" {
+		t.Fatalf("expected idle workflows trimmed, got %v", got)
+	}
+	if got := roots(trimWorkflows(list, 1)); got != "ad" {
+		t.Fatalf("expected running workflows kept, got %v", got)
+	}
+}
+
+func TestGraphDuplicateNames(t *testing.T) {
+	cases := []struct {
+		name  string
+		tasks []TaskSettings
+		err   bool
+	}{
+		{"distinct", []TaskSettings{{Name: "a", Cmd: "x"}, {Name: "b", Cmd: "x"}}, false},
+		{"named", []TaskSettings{{Name: "a", Cmd: "x"}, {Name: "a", Cmd: "y"}}, true},
+		{"unnamed", []TaskSettings{{Cmd: "x"}, {Cmd: "x"}}, true},
+		{"name equals cmd", []TaskSettings{{Name: "x", Cmd: "y"}, {Cmd: "x"}}, true},
+	}
+	for _, c := range cases {
+		_, err := newGraph(c.tasks)
+		if (err != nil) != c.err {
+			t.Errorf("%v: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestGraphCycles(t *testing.T) {
+	cases := []struct {
+		name  string
+		tasks []TaskSettings
+		err   string
+	}{
+		{"chain", []TaskSettings{{Name: "a"}, {Name: "b", After: []string{"a"}}, {Name: "c", After: []string{"b"}}}, ""},
+		{"diamond", []TaskSettings{{Name: "a", OnSuccess: []string{"b", "c"}}, {Name: "b"}, {Name: "c"}, {Name: "d", After: []string{"b", "c"}}}, ""},
+		{"self", []TaskSettings{{Name: "a", After: []string{"a"}}}, "dependency cycle"},
+		{"after", []TaskSettings{{Name: "a", After: []string{"b"}}, {Name: "b", After: []string{"a"}}}, "dependency cycle"},
+		{"success and failure", []TaskSettings{{Name: "a", OnFailure: []string{"b"}}, {Name: "b", OnSuccess: []string{"c"}}, {Name: "c", OnSuccess: []string{"a"}}}, "dependency cycle"},
+		{"unknown", []TaskSettings{{Name: "a", After: []string{"b"}}}, "unknown task"},
+	}
+	for _, c := range cases {
+		_, err := newGraph(c.tasks)
+		if c.err == "" && err != nil {
+			t.Errorf("%v: unexpected error %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%v: error %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestWorkflowReady(t *testing.T) {
+	g, err := newGraph([]TaskSettings{
+		{Name: "extract", OnFailure: []string{"alert"}},
+		{Name: "load", After: []string{"extract"}, OnFailure: []string{"alert"}},
+		{Name: "alert"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		statuses map[string]string
+		start    []string
+		want     map[string]string
+		workflow string
+	}{
+		{
+			"root running",
+			map[string]string{"extract": StepRunning},
+			nil,
+			map[string]string{"load": StepPending, "alert": StepPending},
+			WorkflowRunning,
+		},
+		{
+			"root succeeded",
+			map[string]string{"extract": StepSucceeded},
+			[]string{"load"},
+			map[string]string{"load": StepRunning, "alert": StepPending},
+			WorkflowRunning,
+		},
+		{
+			"all succeeded",
+			map[string]string{"extract": StepSucceeded, "load": StepSucceeded},
+			nil,
+			map[string]string{"alert": StepSkipped},
+			WorkflowSucceeded,
+		},
+		{
+			"root failed",
+			map[string]string{"extract": StepFailed},
+			[]string{"alert"},
+			map[string]string{"load": StepSkipped, "alert": StepRunning},
+			WorkflowRunning,
+		},
+		{
+			"dependent failed",
+			map[string]string{"extract": StepSucceeded, "load": StepFailed},
+			[]string{"alert"},
+			map[string]string{"alert": StepRunning},
+			WorkflowRunning,
+		},
+		{
+			"alerted",
+			map[string]string{"extract": StepFailed, "load": StepSkipped, "alert": StepSucceeded},
+			nil,
+			map[string]string{},
+			WorkflowFailed,
+		},
+	}
+	for _, c := range cases {
+		wf := newWorkflow(g, "extract", testStart)
+		for name, status := range c.statuses {
+			wf.step(name).Status = status
+		}
+		var started []string
+		for _, step := range wf.ready(g, testStart) {
+			started = append(started, step.Task)
+		}
+		if strings.Join(started, ",") != strings.Join(c.start, ",") {
+			t.Errorf("%v: started %v, want %v", c.name, started, c.start)
+		}
+		for name, status := range c.want {
+			if got := wf.step(name).Status; got != status {
+				t.Errorf("%v: step %v is %v, want %v", c.name, name, got, status)
+			}
+		}
+		if wf.Status != c.workflow {
+			t.Errorf("%v: workflow is %v, want %v", c.name, wf.Status, c.workflow)
+		}
+	}
+}
+
+func TestWorkflowReadyJoin(t *testing.T) {
+	g, err := newGraph([]TaskSettings{
+		{Name: "a"},
+		{Name: "b"},
+		{Name: "join", After: []string{"a", "b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf := newWorkflow(g, "a", testStart)
+	if got := wf.step("b").Status; got != StepWaiting {
+		t.Fatalf("other root is %v, want %v", got, StepWaiting)
+	}
+	wf.step("a").Status = StepSucceeded
+	if started := wf.ready(g, testStart); len(started) != 0 || wf.Status != WorkflowRunning {
+		t.Fatalf("join started %v before the other root", started)
+	}
+	wf.step("b").Status = StepSucceeded
+	if started := wf.ready(g, testStart); len(started) != 1 || started[0].Task != "join" {
+		t.Fatalf("started %v, want join", started)
+	}
+
+	wf = newWorkflow(g, "a", testStart)
+	wf.step("a").Status = StepFailed
+	wf.ready(g, testStart)
+	if wf.step("join").Status != StepSkipped || wf.step("b").Status != StepSkipped || wf.Status != WorkflowFailed {
+		t.Errorf("failed root does not skip the join and the other root: %v %v %v", wf.step("join").Status, wf.step("b").Status, wf.Status)
+	}
+}
+
+func TestWorkflowJoinsIndependentRoots(t *testing.T) {
+	s := newTestScheduler(t, []TaskSettings{
+		{Name: "a", Cron: "manual", Cmd: "a"},
+		{Name: "b", Cron: "manual", Cmd: "b"},
+		{Name: "join", Cron: "manual", Cmd: "join", After: []string{"a", "b"}},
+	}, nil)
+	defer s.stop()
+
+	s.run("a")
+	s.waitRunning(1)[0].Exit(0)
+	s.waitStatuses("a", RunDone)
+	s.sync()
+	if got := s.statuses("join"); len(got) != 0 {
+		t.Fatalf("join started after the first root only: %v", got)
+	}
+
+	s.run("b")
+	s.waitRunning(1)[0].Exit(0)
+	s.waitStatuses("b", RunDone)
+	s.waitRunning(1)[0].Exit(0)
+	s.waitStatuses("join", RunDone)
+	s.sync()
+
+	workflows := s.GetWorkflows()
+	if len(workflows) != 1 {
+		t.Fatalf("expected one workflow for both roots, got %d", len(workflows))
+	}
+	if workflows[0].Status != WorkflowSucceeded {
+		t.Errorf("workflow is %v", workflows[0].Status)
+	}
+	if got := s.statuses("join"); len(got) != 1 {
+		t.Errorf("join runs %v, want one", got)
+	}
+}
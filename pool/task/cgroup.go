@@ -0,0 +1,159 @@
+package task
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/stepan-s/jobro/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const cgroupMount = "/sys/fs/cgroup"
+
+// The cgroup for jobro itself, processes can't live in a cgroup with enabled controllers
+const cgroupSupervisor = "supervisor"
+
+// Period for cpu.max quota in microseconds
+const cgroupCpuPeriod = 100000
+
+// Manages cgroups for tasks runs under the jobro cgroup
+type cgroupManager struct {
+	mutex sync.Mutex
+	once  sync.Once
+	base  string
+	err   error
+}
+
+var cgroups cgroupManager
+
+func (manager *cgroupManager) init() error {
+	manager.once.Do(func() {
+		manager.base, manager.err = setupCgroup()
+		if manager.err != nil {
+			log.Warning("Cgroup limits are not available: %v", manager.err)
+		} else {
+			log.Info("Cgroup limits enabled at %v", manager.base)
+		}
+	})
+	return manager.err
+}
+
+func setupCgroup() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return "", errors.New("cgroup v2 is not mounted")
+	}
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	var own string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			own = strings.TrimPrefix(line, "0::")
+		}
+	}
+	if own == "" {
+		return "", errors.New("cgroup v2 path not found")
+	}
+	base := filepath.Join(cgroupMount, own)
+
+	available, err := ioutil.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	var enable []string
+	for _, controller := range strings.Fields(string(available)) {
+		if controller == "memory" || controller == "cpu" || controller == "pids" {
+			enable = append(enable, "+"+controller)
+		}
+	}
+	if len(enable) == 0 {
+		return "", errors.New("memory, cpu and pids controllers are not available")
+	}
+
+	// Move own processes out, then enable controllers for children
+	supervisor := filepath.Join(base, cgroupSupervisor)
+	if err = os.MkdirAll(supervisor, 0755); err != nil {
+		return "", err
+	}
+	procs, err := ioutil.ReadFile(filepath.Join(base, "cgroup.procs"))
+	if err != nil {
+		return "", err
+	}
+	for _, pid := range strings.Fields(string(procs)) {
+		_ = ioutil.WriteFile(filepath.Join(supervisor, "cgroup.procs"), []byte(pid), 0644)
+	}
+	err = ioutil.WriteFile(filepath.Join(base, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0644)
+	if err != nil {
+		return "", err
+	}
+	return base, nil
+}
+
+// create makes a cgroup with the limits
+func (manager *cgroupManager) create(name string, limits Limits) (string, error) {
+	if err := manager.init(); err != nil {
+		return "", err
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	path := filepath.Join(manager.base, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return "", err
+	}
+	var values [][2]string
+	if limits.MemoryMax != "" {
+		bytes, err := ParseBytes(limits.MemoryMax)
+		if err != nil {
+			return path, err
+		}
+		values = append(values, [2]string{"memory.max", strconv.FormatInt(bytes, 10)})
+	}
+	if limits.CpuMax > 0 {
+		quota := int64(limits.CpuMax * cgroupCpuPeriod)
+		values = append(values, [2]string{"cpu.max", fmt.Sprintf("%d %d", quota, cgroupCpuPeriod)})
+	}
+	if limits.PidsMax > 0 {
+		values = append(values, [2]string{"pids.max", strconv.FormatInt(limits.PidsMax, 10)})
+	}
+	for _, value := range values {
+		if err := ioutil.WriteFile(filepath.Join(path, value[0]), []byte(value[1]), 0644); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+func cgroupAdd(path string, pid int) error {
+	return ioutil.WriteFile(filepath.Join(path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// cgroupOomKilled checks whether the OOM killer killed a process in the cgroup
+func cgroupOomKilled(path string) bool {
+	file, err := os.Open(filepath.Join(path, "memory.events"))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			count, _ := strconv.ParseInt(fields[1], 10, 64)
+			return count > 0
+		}
+	}
+	return false
+}
+
+func cgroupRemove(path string) {
+	if err := os.Remove(path); err != nil {
+		log.Warning("Fail remove cgroup %v, error: %v", path, err)
+	}
+}
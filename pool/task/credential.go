@@ -0,0 +1,107 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// User and groups to run a process with
+type RunAs struct {
+	User                string
+	Group               string
+	SupplementaryGroups []string
+}
+
+func (runAs RunAs) IsEmpty() bool {
+	return runAs.User == "" && runAs.Group == "" && len(runAs.SupplementaryGroups) == 0
+}
+
+// Credential resolves names or numeric ids, returns nil if nothing is set.
+// Without supplementary groups the user groups are used.
+func (runAs RunAs) Credential() (*syscall.Credential, error) {
+	if runAs.IsEmpty() {
+		return nil, nil
+	}
+	credential := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	var usr *user.User
+	if runAs.User != "" {
+		var err error
+		usr, err = lookupUser(runAs.User)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(usr.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %v of user %v", usr.Uid, runAs.User)
+		}
+		credential.Uid = uint32(uid)
+		if usr.Gid != "" {
+			gid, err := strconv.ParseUint(usr.Gid, 10, 32)
+			if err == nil {
+				credential.Gid = uint32(gid)
+			}
+		}
+	}
+
+	if runAs.Group != "" {
+		gid, err := lookupGroup(runAs.Group)
+		if err != nil {
+			return nil, err
+		}
+		credential.Gid = gid
+	}
+
+	groups := runAs.SupplementaryGroups
+	if len(groups) == 0 && usr != nil && usr.Username != "" {
+		groups, _ = usr.GroupIds()
+	}
+	for _, name := range groups {
+		gid, err := lookupGroup(name)
+		if err != nil {
+			return nil, err
+		}
+		credential.Groups = append(credential.Groups, gid)
+	}
+	if credential.Groups == nil {
+		credential.Groups = []uint32{}
+	}
+	return credential, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	usr, err := user.Lookup(name)
+	if err == nil {
+		return usr, nil
+	}
+	if _, e := strconv.ParseUint(name, 10, 32); e != nil {
+		return nil, fmt.Errorf("unknown user %v: %v", name, err)
+	}
+	usr, err = user.LookupId(name)
+	if err == nil {
+		return usr, nil
+	}
+	// Numeric id without passwd entry
+	return &user.User{Uid: name}, nil
+}
+
+func lookupGroup(name string) (uint32, error) {
+	grp, err := user.LookupGroup(name)
+	if err != nil {
+		if gid, e := strconv.ParseUint(name, 10, 32); e == nil {
+			return uint32(gid), nil
+		}
+		return 0, fmt.Errorf("unknown group %v: %v", name, err)
+	}
+	gid, err := strconv.ParseUint(grp.Gid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid gid %v of group %v", grp.Gid, name)
+	}
+	return uint32(gid), nil
+}
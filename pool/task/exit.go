@@ -0,0 +1,90 @@
+package task
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// How the process exited
+type Exit struct {
+	Code       int    `json:"code"`
+	Signal     string `json:"signal,omitempty"`
+	CoreDumped bool   `json:"core_dumped,omitempty"`
+	// Wait error other than the exit status
+	Error string `json:"error,omitempty"`
+	// Resource limit killed the process
+	Reason     string   `json:"reason,omitempty"`
+	UserTime   Duration `json:"user_time"`
+	SystemTime Duration `json:"system_time"`
+	// Max resident set size in bytes
+	MaxRss   int64    `json:"max_rss"`
+	WallTime Duration `json:"wall_time"`
+}
+
+func (exit *Exit) Failed() bool {
+	return exit.Code != 0 || exit.Signal != "" || exit.Error != ""
+}
+
+// Exit counters of a task or pool
+type ExitStats struct {
+	Signaled   int64    `json:"signaled"`
+	CoreDumps  int64    `json:"core_dumps"`
+	UserTime   Duration `json:"user_time"`
+	SystemTime Duration `json:"system_time"`
+	// Max resident set size of all runs in bytes
+	MaxRss int64 `json:"max_rss"`
+}
+
+func (stats *ExitStats) Add(exit *Exit) {
+	if exit == nil {
+		return
+	}
+	if exit.Signal != "" {
+		stats.Signaled += 1
+	}
+	if exit.CoreDumped {
+		stats.CoreDumps += 1
+	}
+	stats.UserTime += exit.UserTime
+	stats.SystemTime += exit.SystemTime
+	if exit.MaxRss > stats.MaxRss {
+		stats.MaxRss = exit.MaxRss
+	}
+}
+
+func (stats *ExitStats) Merge(other ExitStats) {
+	stats.Signaled += other.Signaled
+	stats.CoreDumps += other.CoreDumps
+	stats.UserTime += other.UserTime
+	stats.SystemTime += other.SystemTime
+	if other.MaxRss > stats.MaxRss {
+		stats.MaxRss = other.MaxRss
+	}
+}
+
+// exitOf describes the process exit by its state and the wait error
+func exitOf(state *os.ProcessState, started time.Time, err error) *Exit {
+	exit := &Exit{Code: -1, WallTime: Duration(time.Since(started))}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			exit.Error = err.Error()
+		}
+	}
+	if state == nil {
+		return exit
+	}
+	exit.Code = state.ExitCode()
+	exit.UserTime = Duration(state.UserTime())
+	exit.SystemTime = Duration(state.SystemTime())
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exit.Signal = SignalName(status.Signal())
+		exit.CoreDumped = status.CoreDump()
+	}
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// Linux reports kilobytes
+		exit.MaxRss = usage.Maxrss * 1024
+	}
+	return exit
+}
@@ -0,0 +1,153 @@
+package task
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+)
+
+// Fake pids are above the system pid limit to not clash with real processes in the registry
+const fakePidBase = 1 << 23
+
+var fakePids = struct {
+	sync.Mutex
+	last int
+}{last: fakePidBase}
+
+// FakeRunner keeps processes in memory, they exit on a signal or by Exit
+type FakeRunner struct {
+	mutex     sync.Mutex
+	processes []*FakeProcess
+	// Spawn fails with the error if set
+	spawnError error
+	// Signals the processes ignore, SIGKILL is never ignored, set it before spawn
+	Ignore map[syscall.Signal]bool
+	// Called with every spawned process, e.g. to exit short commands at once, set it before spawn
+	OnSpawn func(process *FakeProcess)
+}
+
+type FakeProcess struct {
+	Spec    Spec
+	pid     int
+	runner  *FakeRunner
+	mutex   sync.Mutex
+	signals []syscall.Signal
+	exit    *Exit
+	done    chan bool
+}
+
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{Ignore: map[syscall.Signal]bool{}}
+}
+
+func (runner *FakeRunner) Spawn(spec Spec) (Process, error) {
+	runner.mutex.Lock()
+	if runner.spawnError != nil {
+		runner.mutex.Unlock()
+		return nil, runner.spawnError
+	}
+	fakePids.Lock()
+	fakePids.last += 1
+	pid := fakePids.last
+	fakePids.Unlock()
+	process := &FakeProcess{Spec: spec, pid: pid, runner: runner, done: make(chan bool)}
+	runner.processes = append(runner.processes, process)
+	onSpawn := runner.OnSpawn
+	runner.mutex.Unlock()
+	if onSpawn != nil {
+		onSpawn(process)
+	}
+	return process, nil
+}
+
+// SetSpawnError makes next spawns fail with the error, nil makes them succeed
+func (runner *FakeRunner) SetSpawnError(err error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	runner.spawnError = err
+}
+
+// Processes returns all spawned processes
+func (runner *FakeRunner) Processes() []*FakeProcess {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	return append([]*FakeProcess{}, runner.processes...)
+}
+
+// Running returns processes not exited yet
+func (runner *FakeRunner) Running() []*FakeProcess {
+	var running []*FakeProcess
+	for _, process := range runner.Processes() {
+		if !process.Exited() {
+			running = append(running, process)
+		}
+	}
+	return running
+}
+
+func (runner *FakeRunner) ignores(signal syscall.Signal) bool {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	return signal != syscall.SIGKILL && runner.Ignore[signal]
+}
+
+func (process *FakeProcess) Pid() int {
+	return process.pid
+}
+
+func (process *FakeProcess) Wait() *Exit {
+	<-process.done
+	process.mutex.Lock()
+	defer process.mutex.Unlock()
+	return process.exit
+}
+
+func (process *FakeProcess) Signal(signal syscall.Signal) error {
+	process.mutex.Lock()
+	if process.exit != nil {
+		process.mutex.Unlock()
+		return syscall.ESRCH
+	}
+	process.signals = append(process.signals, signal)
+	process.mutex.Unlock()
+	if !process.runner.ignores(signal) {
+		process.finish(&Exit{Code: -1, Signal: SignalName(signal)})
+	}
+	return nil
+}
+
+func (process *FakeProcess) Members() []int {
+	return nil
+}
+
+// Exit finishes the process with the code
+func (process *FakeProcess) Exit(code int) error {
+	if !process.finish(&Exit{Code: code}) {
+		return errors.New("process already exited")
+	}
+	return nil
+}
+
+func (process *FakeProcess) finish(exit *Exit) bool {
+	process.mutex.Lock()
+	defer process.mutex.Unlock()
+	if process.exit != nil {
+		return false
+	}
+	process.exit = exit
+	close(process.done)
+	return true
+}
+
+func (process *FakeProcess) Exited() bool {
+	process.mutex.Lock()
+	defer process.mutex.Unlock()
+	return process.exit != nil
+}
+
+// Signals returns signals received by the process
+func (process *FakeProcess) Signals() []syscall.Signal {
+	process.mutex.Lock()
+	defer process.mutex.Unlock()
+	return append([]syscall.Signal{}, process.signals...)
+}
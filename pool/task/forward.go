@@ -0,0 +1,53 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Signals handled by jobro itself or which can not be caught
+var notForwarded = map[syscall.Signal]bool{
+	syscall.SIGINT:  true,
+	syscall.SIGQUIT: true,
+	syscall.SIGTERM: true,
+	syscall.SIGUSR1: true,
+	syscall.SIGKILL: true,
+	syscall.SIGSTOP: true,
+}
+
+// Signal to forward to managed processes, to all groups if groups are not set
+type ForwardRule struct {
+	Signal syscall.Signal
+	Groups []string
+}
+
+// ParseForwardSignals parses list like "HUP,USR2:groupA|groupB,WINCH"
+func ParseForwardSignals(spec string) ([]ForwardRule, error) {
+	var rules []ForwardRule
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name := item
+		var groups []string
+		if i := strings.IndexByte(item, ':'); i >= 0 {
+			name = item[:i]
+			for _, group := range strings.Split(item[i+1:], "|") {
+				if group != "" {
+					groups = append(groups, group)
+				}
+			}
+		}
+		signal, err := ParseSignal(name)
+		if err != nil {
+			return nil, err
+		}
+		if notForwarded[signal] {
+			return nil, fmt.Errorf("signal %v can not be forwarded", name)
+		}
+		rules = append(rules, ForwardRule{signal, groups})
+	}
+	return rules, nil
+}
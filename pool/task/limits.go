@@ -0,0 +1,76 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reasons of a process termination caused by limits
+const ReasonOom = "oom"
+const ReasonCpuLimit = "cpu_limit"
+
+// Resource limits of a process.
+// Rlimits are applied by the spawn helper before exec, cgroup limits require a writable cgroup v2 hierarchy.
+type Limits struct {
+	Nofile *uint64 `json:"nofile"`
+	Nproc  *uint64 `json:"nproc"`
+	// Address space in bytes
+	As *uint64 `json:"as"`
+	// CPU time in seconds
+	Cpu *uint64 `json:"cpu"`
+	// Core file size in bytes
+	Core *uint64 `json:"core"`
+	// Bytes, K, M and G suffixes are allowed
+	MemoryMax string `json:"memory_max"`
+	// Number of CPUs, 0.5 - half of one CPU
+	CpuMax  float64 `json:"cpu_max"`
+	PidsMax int64   `json:"pids_max"`
+}
+
+func (limits Limits) hasRlimits() bool {
+	return limits.Nofile != nil || limits.Nproc != nil || limits.As != nil || limits.Cpu != nil || limits.Core != nil
+}
+
+func (limits Limits) hasCgroup() bool {
+	return limits.MemoryMax != "" || limits.CpuMax > 0 || limits.PidsMax > 0
+}
+
+func (limits Limits) Validate() error {
+	if limits.MemoryMax != "" {
+		if _, err := ParseBytes(limits.MemoryMax); err != nil {
+			return err
+		}
+	}
+	if limits.CpuMax < 0 {
+		return fmt.Errorf("invalid cpu_max: %v", limits.CpuMax)
+	}
+	if limits.PidsMax < 0 {
+		return fmt.Errorf("invalid pids_max: %v", limits.PidsMax)
+	}
+	return nil
+}
+
+// ParseBytes parses size in bytes with optional K, M or G suffix
+func ParseBytes(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	multiplier := int64(1)
+	if value != "" {
+		switch strings.ToUpper(value[len(value)-1:]) {
+		case "K":
+			multiplier = 1 << 10
+		case "M":
+			multiplier = 1 << 20
+		case "G":
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size: %v", value)
+	}
+	return number * multiplier, nil
+}
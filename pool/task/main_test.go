@@ -0,0 +1,14 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stepan-s/jobro/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(ioutil.Discard, log.NONE)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,96 @@
+package task
+
+import (
+	"fmt"
+	"github.com/stepan-s/jobro/clock"
+	"github.com/stepan-s/jobro/log"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Spawn options of a task
+type Options struct {
+	Credential  *syscall.Credential
+	Limits      Limits
+	StopSignal  syscall.Signal
+	StopTimeout time.Duration
+	Env         []string
+	// ExecRunner, the real clock and the shared registry if not set
+	Runner   Runner
+	Clock    clock.Clock
+	Registry *Registry
+	// Log of the processes, the global log if nil
+	Logger *log.Logger
+}
+
+func (options Options) runner() Runner {
+	if options.Runner == nil {
+		return ExecRunner{}
+	}
+	return options.Runner
+}
+
+func (options Options) registry() *Registry {
+	if options.Registry == nil {
+		return processes
+	}
+	return options.Registry
+}
+
+func (options Options) clock() clock.Clock {
+	if options.Clock == nil {
+		return clock.Real
+	}
+	return options.Clock
+}
+
+// Settings shared by scheduled tasks and instant pools
+type SpawnSettings struct {
+	// User and groups by name or numeric id, the "group" key is taken by the concurrency group of tasks and pools
+	User                string   `json:"user"`
+	UserGroup           string   `json:"user_group"`
+	SupplementaryGroups []string `json:"supplementary_groups"`
+	Limits              Limits   `json:"limits"`
+	// Signal to stop the process, SIGINT by default
+	StopSignal string `json:"stop_signal"`
+	// Time to wait after the stop signal before SIGKILL, 0 - wait forever
+	StopTimeout Duration `json:"stop_timeout"`
+	// Additional environment of the process
+	Env map[string]string `json:"env"`
+}
+
+func (settings SpawnSettings) Options() (Options, error) {
+	runAs := RunAs{User: settings.User, Group: settings.UserGroup, SupplementaryGroups: settings.SupplementaryGroups}
+	credential, err := runAs.Credential()
+	if err != nil {
+		return Options{}, err
+	}
+	err = settings.Limits.Validate()
+	if err != nil {
+		return Options{}, err
+	}
+	stopSignal := syscall.SIGINT
+	if settings.StopSignal != "" {
+		stopSignal, err = ParseSignal(settings.StopSignal)
+		if err != nil {
+			return Options{}, err
+		}
+	}
+	var env []string
+	for name, value := range settings.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return Options{}, fmt.Errorf("invalid env name: %q", name)
+		}
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return Options{
+		Env:         env,
+		Credential:  credential,
+		Limits:      settings.Limits,
+		StopSignal:  stopSignal,
+		StopTimeout: settings.StopTimeout.Duration(),
+	}, nil
+}
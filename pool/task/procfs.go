@@ -0,0 +1,118 @@
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock ticks per second of /proc/<pid>/stat times, USER_HZ is 100 on Linux
+const clockTicks = 100
+
+type procStat struct {
+	pid   int
+	state string
+	ppid  int
+	pgrp  int
+}
+
+func readProcStat(pid int) (procStat, bool) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return procStat{}, false
+	}
+	// The command name is in parentheses and can contain anything
+	line := string(data)
+	end := strings.LastIndexByte(line, ')')
+	if end < 0 {
+		return procStat{}, false
+	}
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 3 {
+		return procStat{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	pgrp, _ := strconv.Atoi(fields[2])
+	return procStat{pid, fields[0], ppid, pgrp}, true
+}
+
+func listProcs() []procStat {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var list []procStat
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, ok := readProcStat(pid); ok {
+			list = append(list, stat)
+		}
+	}
+	return list
+}
+
+// groupMembers returns alive processes of the process group
+func groupMembers(pgid int) []int {
+	var pids []int
+	for _, stat := range listProcs() {
+		if stat.pgrp == pgid && stat.state != "Z" {
+			pids = append(pids, stat.pid)
+		}
+	}
+	return pids
+}
+
+// ProcessRss returns resident set size of the process in bytes
+func ProcessRss(pid int) (int64, error) {
+	file, err := os.Open("/proc/" + strconv.Itoa(pid) + "/status")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb << 10, nil
+		}
+	}
+	return 0, fmt.Errorf("no VmRSS for pid %d", pid)
+}
+
+// ProcessCpuTime returns user and system time of the process
+func ProcessCpuTime(pid int) (time.Duration, error) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, err
+	}
+	line := string(data)
+	end := strings.LastIndexByte(line, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("invalid stat of pid %d", pid)
+	}
+	// utime and stime are the 14th and 15th fields, the state is the 3rd
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("invalid stat of pid %d", pid)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, nil
+}
@@ -0,0 +1,95 @@
+package task
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/stepan-s/jobro/log"
+)
+
+// Processes are started under the read lock and reaped under the write lock,
+// so the reaper never sees a started process before its waiter is registered
+var spawnLock sync.RWMutex
+
+// Pids with a pending os/exec waiter, the reaper leaves them to cmd.Wait
+var waiters = struct {
+	mutex sync.Mutex
+	pids  map[int]int
+}{pids: map[int]int{}}
+
+func addWaiter(pid int) {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+	waiters.pids[pid] += 1
+}
+
+func removeWaiter(pid int) {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+	waiters.pids[pid] -= 1
+	if waiters.pids[pid] <= 0 {
+		delete(waiters.pids, pid)
+	}
+}
+
+func hasWaiter(pid int) bool {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+	return waiters.pids[pid] > 0
+}
+
+// StartReaper registers the process as a child subreaper and reaps zombies of not waited processes
+func StartReaper() error {
+	err := setSubreaper()
+	if err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGCHLD)
+	go func() {
+		for range signals {
+			reapZombies()
+		}
+	}()
+	// Orphans could be adopted before the handler was set
+	reapZombies()
+	return nil
+}
+
+// reapZombies reaps all exited children without a pending waiter
+func reapZombies() {
+	spawnLock.Lock()
+	defer spawnLock.Unlock()
+	for {
+		pid, err := peekZombie()
+		if err != nil || pid <= 0 {
+			return
+		}
+		if hasWaiter(pid) {
+			// Wait4(-1) would steal the waited zombie, other zombies are looked up one by one
+			reapOrphans()
+			return
+		}
+		reapPid(pid)
+	}
+}
+
+// reapOrphans reaps zombie children without a pending waiter found in /proc
+func reapOrphans() {
+	self := os.Getpid()
+	for _, stat := range listProcs() {
+		if stat.state == "Z" && stat.ppid == self && !hasWaiter(stat.pid) {
+			reapPid(stat.pid)
+		}
+	}
+}
+
+func reapPid(pid int) {
+	var status syscall.WaitStatus
+	reaped, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+	if err == nil && reaped == pid {
+		log.Debug("Reaped zombie %d, status: %d", pid, status.ExitStatus())
+	}
+}
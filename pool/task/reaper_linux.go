@@ -0,0 +1,36 @@
+package task
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetChildSubreaper = 36
+	pAll                = 0
+	wNoWait             = 0x1000000
+)
+
+func setSubreaper() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// peekZombie returns pid of an exited child leaving it waitable, 0 if there is none
+func peekZombie() (int, error) {
+	// siginfo_t is 128 bytes, si_pid follows signo, errno, code and the union alignment
+	var info [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pAll, 0, uintptr(unsafe.Pointer(&info[0])),
+		syscall.WEXITED|syscall.WNOHANG|wNoWait, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	offset := 12
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		offset = 16
+	}
+	return int(*(*int32)(unsafe.Pointer(&info[offset]))), nil
+}
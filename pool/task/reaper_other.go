@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package task
+
+import (
+	"errors"
+)
+
+func setSubreaper() error {
+	return errors.New("subreaper is not supported")
+}
+
+func peekZombie() (int, error) {
+	return 0, errors.New("waitid is not supported")
+}
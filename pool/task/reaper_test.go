@@ -0,0 +1,67 @@
+package task
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func zombieChildren() []int {
+	self := os.Getpid()
+	var pids []int
+	for _, stat := range listProcs() {
+		if stat.state == "Z" && stat.ppid == self {
+			pids = append(pids, stat.pid)
+		}
+	}
+	return pids
+}
+
+func TestReaperLeavesWaitedProcesses(t *testing.T) {
+	if err := StartReaper(); err != nil {
+		t.Skipf("reaper is not supported: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			process, err := ExecRunner{}.Spawn(Spec{Args: []string{"sh", "-c", "exit 3"}})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if exit := process.Wait(); exit.Code != 3 || exit.Error != "" {
+				t.Errorf("exit %+v, want code 3", exit)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The orphaned sleep is adopted by the subreaper
+	var out bytes.Buffer
+	process, err := ExecRunner{}.Spawn(Spec{Args: []string{"sh", "-c", "sleep 0.1 & echo $!"}, Stdout: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	process.Wait()
+	orphan, err := strconv.Atoi(strings.TrimSpace(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, alive := readProcStat(orphan); !alive {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("orphan %d is not reaped, zombies: %v", orphan, zombieChildren())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,120 @@
+package task
+
+import (
+	"sync"
+	"syscall"
+)
+
+type process struct {
+	group   string
+	cmd     string
+	killed  bool
+	process Process
+}
+
+// Registry of running managed processes with their groups
+type Registry struct {
+	mutex sync.Mutex
+	pids  map[int]*process
+}
+
+func NewRegistry() *Registry {
+	return &Registry{pids: map[int]*process{}}
+}
+
+// Used by tasks without own registry
+var processes = NewRegistry()
+
+func (r *Registry) add(pid int, group string, cmd string, proc Process) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pids[pid] = &process{group: group, cmd: cmd, process: proc}
+}
+
+// remove returns whether the process was force killed
+func (r *Registry) remove(pid int) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	proc, ok := r.pids[pid]
+	if !ok {
+		return false
+	}
+	delete(r.pids, pid)
+	return proc.killed
+}
+
+// kill sends SIGKILL to the process group if the process is still running
+func (r *Registry) kill(pid int) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	proc, ok := r.pids[pid]
+	if !ok {
+		return false
+	}
+	proc.killed = true
+	_ = proc.process.Signal(syscall.SIGKILL)
+	return true
+}
+
+// signal signals the process group of the running process
+func (r *Registry) signal(pid int, signal syscall.Signal) error {
+	r.mutex.Lock()
+	proc, ok := r.pids[pid]
+	r.mutex.Unlock()
+	if !ok {
+		return syscall.ESRCH
+	}
+	return proc.process.Signal(signal)
+}
+
+// list returns pids of the groups, all pids if groups are not set
+func (r *Registry) list(groups []string) []int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var pids []int
+	for pid, proc := range r.pids {
+		if len(groups) == 0 {
+			pids = append(pids, pid)
+			continue
+		}
+		for _, g := range groups {
+			if g == proc.group {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+	return pids
+}
+
+// Signal sends the signal to process groups of the registry processes of the groups, all if groups are not set
+func (r *Registry) Signal(signal syscall.Signal, groups []string) int {
+	pids := r.list(groups)
+	for _, pid := range pids {
+		_ = r.signal(pid, signal)
+	}
+	return len(pids)
+}
+
+// Killed process report
+type KilledProcess struct {
+	Pid   int    `json:"pid"`
+	Group string `json:"group"`
+	Cmd   string `json:"cmd"`
+}
+
+// KillAll sends SIGKILL to process groups of the registry processes not killed yet
+func (r *Registry) KillAll() []KilledProcess {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var killed []KilledProcess
+	for pid, proc := range r.pids {
+		if proc.killed {
+			continue
+		}
+		proc.killed = true
+		_ = proc.process.Signal(syscall.SIGKILL)
+		killed = append(killed, KilledProcess{pid, proc.group, proc.cmd})
+	}
+	return killed
+}
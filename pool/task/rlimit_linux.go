@@ -0,0 +1,36 @@
+package task
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const rlimitNproc = 0x6
+
+func applyRlimits(limits Limits) error {
+	resources := []struct {
+		name     string
+		resource int
+		value    *uint64
+	}{
+		{"nofile", syscall.RLIMIT_NOFILE, limits.Nofile},
+		{"nproc", rlimitNproc, limits.Nproc},
+		{"as", syscall.RLIMIT_AS, limits.As},
+		{"cpu", syscall.RLIMIT_CPU, limits.Cpu},
+		{"core", syscall.RLIMIT_CORE, limits.Core},
+	}
+	for _, r := range resources {
+		if r.value == nil {
+			continue
+		}
+		rlimit := syscall.Rlimit{Cur: *r.value, Max: *r.value}
+		if r.resource == syscall.RLIMIT_CPU {
+			// SIGXCPU on the soft limit, SIGKILL a second later
+			rlimit.Max += 1
+		}
+		if err := syscall.Setrlimit(r.resource, &rlimit); err != nil {
+			return fmt.Errorf("set rlimit %v=%d: %v", r.name, *r.value, err)
+		}
+	}
+	return nil
+}
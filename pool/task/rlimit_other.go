@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package task
+
+import (
+	"errors"
+)
+
+func applyRlimits(limits Limits) error {
+	if limits.hasRlimits() {
+		return errors.New("rlimits are supported on linux only")
+	}
+	return nil
+}
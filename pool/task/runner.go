@@ -0,0 +1,187 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Process to spawn
+type Spec struct {
+	Args []string
+	// Additional environment
+	Env []string
+	// Unique name of the run, the cgroup of the process is named by it
+	Name string
+	// Output of the process, discarded if nil
+	Stdout  io.Writer
+	Options Options
+}
+
+// Spawns processes, ExecRunner by default and FakeRunner in tests
+type Runner interface {
+	Spawn(spec Spec) (Process, error)
+}
+
+type Process interface {
+	Pid() int
+	// Wait waits for the exit, Exit.Error is set if the wait failed
+	Wait() *Exit
+	// Signal signals the process group
+	Signal(signal syscall.Signal) error
+	// Members returns pids left in the process group
+	Members() []int
+}
+
+// Execute spawns the process by the runner of the options and waits for it.
+// The process group is killed after the timeout, 0 - no timeout.
+func Execute(spec Spec, timeout time.Duration) error {
+	process, err := spec.Options.runner().Spawn(spec)
+	if err != nil {
+		return err
+	}
+	var timedOut int32
+	if timeout > 0 {
+		timer := spec.Options.clock().AfterFunc(timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			_ = process.Signal(syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+	exit := process.Wait()
+	switch {
+	case atomic.LoadInt32(&timedOut) == 1:
+		return fmt.Errorf("timeout %v", timeout)
+	case exit.Error != "":
+		return errors.New(exit.Error)
+	case exit.Signal != "":
+		return fmt.Errorf("killed by %v", exit.Signal)
+	case exit.Code != 0:
+		return fmt.Errorf("exit code %d", exit.Code)
+	}
+	return nil
+}
+
+// ExecRunner spawns processes of the system
+type ExecRunner struct{}
+
+type execProcess struct {
+	cmd        *exec.Cmd
+	limits     Limits
+	cgroupPath string
+	started    time.Time
+}
+
+func (ExecRunner) Spawn(spec Spec) (Process, error) {
+	args := spec.Args
+	limits := spec.Options.Limits
+	var cmd *exec.Cmd
+	var sync *os.File
+	var err error
+	if limits.hasRlimits() || limits.hasCgroup() {
+		cmd, err = helperCommand(limits, args)
+		if err != nil {
+			return nil, err
+		}
+		if limits.hasCgroup() {
+			var reader *os.File
+			reader, sync, err = os.Pipe()
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			defer sync.Close()
+			cmd.ExtraFiles = []*os.File{reader}
+			cmd.Env = append(cmd.Env, spawnSyncEnv+"=1")
+		}
+	} else {
+		cmd = exec.Command(args[0], args[1:]...)
+	}
+	if len(spec.Options.Env) > 0 || len(spec.Env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(append(cmd.Env, spec.Options.Env...), spec.Env...)
+	}
+	cmd.Stdout = spec.Stdout
+	// Own process group to signal the whole tree
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Credential: spec.Options.Credential,
+	}
+
+	process := &execProcess{cmd: cmd, limits: limits, started: time.Now()}
+	spawnLock.RLock()
+	err = cmd.Start()
+	if err == nil {
+		addWaiter(cmd.Process.Pid)
+	}
+	spawnLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	pid := cmd.Process.Pid
+	if sync != nil {
+		process.cgroupPath, err = cgroups.create(spec.Name, limits)
+		if err == nil {
+			err = cgroupAdd(process.cgroupPath, pid)
+		}
+		if err != nil {
+			spec.Options.Logger.Error("Fail apply cgroup limits to pid %d, error: %v", pid, err)
+		}
+		_, _ = sync.Write([]byte{0})
+		_ = sync.Close()
+	}
+	return process, nil
+}
+
+func (process *execProcess) Pid() int {
+	return process.cmd.Process.Pid
+}
+
+func (process *execProcess) Wait() *Exit {
+	err := process.cmd.Wait()
+	removeWaiter(process.Pid())
+	exit := exitOf(process.cmd.ProcessState, process.started, err)
+	if err != nil && process.cmd.ProcessState != nil {
+		exit.Reason = limitReason(process.limits, process.cgroupPath, process.cmd.ProcessState)
+	}
+	if process.cgroupPath != "" {
+		cgroupRemove(process.cgroupPath)
+	}
+	return exit
+}
+
+func (process *execProcess) Signal(signal syscall.Signal) error {
+	return signalGroup(process.Pid(), signal)
+}
+
+func (process *execProcess) Members() []int {
+	return groupMembers(process.Pid())
+}
+
+// limitReason detects whether the process was killed because of the limits
+func limitReason(limits Limits, cgroupPath string, state *os.ProcessState) string {
+	if cgroupPath != "" && limits.MemoryMax != "" && cgroupOomKilled(cgroupPath) {
+		return ReasonOom
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return ReasonCpuLimit
+	case syscall.SIGKILL:
+		if limits.Cpu != nil && (state.UserTime()+state.SystemTime()).Seconds() >= float64(*limits.Cpu) {
+			return ReasonCpuLimit
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":    syscall.SIGHUP,
+	"INT":    syscall.SIGINT,
+	"QUIT":   syscall.SIGQUIT,
+	"KILL":   syscall.SIGKILL,
+	"TERM":   syscall.SIGTERM,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"WINCH":  syscall.SIGWINCH,
+	"ALRM":   syscall.SIGALRM,
+	"CONT":   syscall.SIGCONT,
+	"STOP":   syscall.SIGSTOP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"IO":     syscall.SIGIO,
+	"PROF":   syscall.SIGPROF,
+	"VTALRM": syscall.SIGVTALRM,
+	"PIPE":   syscall.SIGPIPE,
+	"ABRT":   syscall.SIGABRT,
+	"SEGV":   syscall.SIGSEGV,
+	"BUS":    syscall.SIGBUS,
+	"FPE":    syscall.SIGFPE,
+	"ILL":    syscall.SIGILL,
+	"TRAP":   syscall.SIGTRAP,
+	"SYS":    syscall.SIGSYS,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+}
+
+// ParseSignal parses signal name like "TERM" or "SIGTERM"
+func ParseSignal(name string) (syscall.Signal, error) {
+	signal, ok := signalNames[strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %v", name)
+	}
+	return signal, nil
+}
+
+// SignalName returns the name like "TERM" for known signals
+func SignalName(signal syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == signal {
+			return name
+		}
+	}
+	return signal.String()
+}
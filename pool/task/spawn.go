@@ -0,0 +1,77 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Environment of the spawn helper
+const spawnLimitsEnv = "JOBRO_SPAWN_LIMITS"
+const spawnSyncEnv = "JOBRO_SPAWN_SYNC"
+
+// The spawn helper receives the sync pipe as the first extra file
+const spawnSyncFd = 3
+
+// The spawn helper runs before main of any program importing the package
+func init() {
+	spawnHelper()
+}
+
+// spawnHelper turns the process into the command when it was started as the spawn helper,
+// applying limits before exec
+func spawnHelper() {
+	data, ok := os.LookupEnv(spawnLimitsEnv)
+	if !ok {
+		return
+	}
+	_ = os.Unsetenv(spawnLimitsEnv)
+	fail := func(format string, v ...interface{}) {
+		_, _ = fmt.Fprintf(os.Stderr, "jobro spawn: "+format+"\n", v...)
+		os.Exit(127)
+	}
+
+	var limits Limits
+	if err := json.Unmarshal([]byte(data), &limits); err != nil {
+		fail("invalid limits: %v", err)
+	}
+	if err := applyRlimits(limits); err != nil {
+		fail("%v", err)
+	}
+
+	// Wait while the parent places the process to the cgroup
+	if _, ok := os.LookupEnv(spawnSyncEnv); ok {
+		_ = os.Unsetenv(spawnSyncEnv)
+		sync := os.NewFile(spawnSyncFd, "sync")
+		buf := make([]byte, 1)
+		_, _ = sync.Read(buf)
+		_ = sync.Close()
+	}
+
+	if len(os.Args) < 2 {
+		fail("no command")
+	}
+	path, err := exec.LookPath(os.Args[1])
+	if err != nil {
+		fail("%v", err)
+	}
+	err = syscall.Exec(path, os.Args[1:], os.Environ())
+	fail("exec %v: %v", path, err)
+}
+
+// helperCommand wraps the command into the spawn helper
+func helperCommand(limits Limits, args []string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self, args...)
+	cmd.Env = append(os.Environ(), spawnLimitsEnv+"="+string(data))
+	return cmd, nil
+}
@@ -3,9 +3,8 @@ package task
 import (
 	"github.com/google/uuid"
 	"github.com/mattn/go-shellwords"
-	"github.com/stepan-s/jobro/log"
-	"os"
-	"os/exec"
+	"sync"
+	"syscall"
 )
 
 const FailStart = 0
@@ -14,20 +13,43 @@ const Start = 1
 const Stop = -1
 
 type Notify struct {
-	Action int
-	Pid    int
-	Id     uuid.UUID
+	Action   int
+	Pid      int
+	Id       uuid.UUID
+	Run      uuid.UUID
+	ExitCode int
+	Reason   string
+	// Processes left in the group after the main process exit
+	Leftover []int
+	// Process was killed after the stop timeout
+	Killed bool
+	// Exit state, set on Error and Stop
+	Exit *Exit
+}
+
+type Run struct {
+	Id          uuid.UUID
+	Description string
+	Group       string
+	// Additional environment
+	Env []string
+	// Values for the command template
+	Vars interface{}
 }
 
 type Task struct {
-	cmd   string
-	id    uuid.UUID
-	state chan Notify
-	pids  []int
+	cmd     string
+	options Options
+	id      uuid.UUID
+	state   chan Notify
+	// Guards pids and cancelled, they are changed by Exec goroutines
+	mutex     sync.Mutex
+	pids      []int
+	cancelled []int
 }
 
-func New(cmd string, notifyChannel chan Notify) Task {
-	return Task{cmd, uuid.New(), notifyChannel, []int{}}
+func New(cmd string, options Options, notifyChannel chan Notify) *Task {
+	return &Task{cmd: cmd, options: options, id: uuid.New(), state: notifyChannel, pids: []int{}, cancelled: []int{}}
 }
 
 func (task *Task) GetId() uuid.UUID {
@@ -39,93 +61,135 @@ func (task *Task) GetCmd() string {
 }
 
 func (task *Task) GetRunning() int {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
 	return len(task.pids)
 }
 
-func (task *Task) Exec(execDescription string) {
+func (task *Task) Exec(run Run) {
 	pid := 0
+	var process Process
+	var exit *Exit
 
 	defer func() {
 		if pid != 0 {
-			task.state <- Notify{Stop, pid, task.id}
-			var pids []int
-			for _, p := range task.pids {
-				if p != pid {
-					pids = append(pids, p)
+			leftover := process.Members()
+			if len(leftover) > 0 {
+				task.options.Logger.Warning("Task %v exited and left processes in its group: %v", pid, leftover)
+				if task.isCancelled(pid) {
+					_ = process.Signal(syscall.SIGKILL)
 				}
 			}
-			task.pids = pids
+			task.forget(pid)
+			task.state <- Notify{Action: Stop, Pid: pid, Id: task.id, Run: run.Id, Leftover: leftover, Exit: exit}
 			pid = 0
 		}
 	}()
 
 	var err error
 	var args []string
-	args, err = shellwords.Parse(task.cmd)
+	line := task.cmd
+	if run.Vars != nil {
+		line, err = ExpandCmd(task.cmd, run.Vars)
+		if err != nil {
+			task.state <- Notify{Action: FailStart, Pid: pid, Id: task.id, Run: run.Id}
+			task.options.Logger.Error("Fail expand cmd, %s Task: %v, error: %v", run.Description, task.cmd, err)
+			return
+		}
+	}
+	args, err = shellwords.Parse(line)
 	if err != nil {
-		task.state <- Notify{FailStart, pid, task.id}
-		log.Error("Fail parse args, %s Task: %v, error: %v", execDescription, task.cmd, err)
+		task.state <- Notify{Action: FailStart, Pid: pid, Id: task.id, Run: run.Id}
+		task.options.Logger.Error("Fail parse args, %s Task: %v, error: %v", run.Description, task.cmd, err)
 		return
 	}
 
-	command := args[0]
-	cmd := exec.Command(command, args[1:]...);
-
-	log.Debug("Start process %v, with: %v", command, args)
-	err = cmd.Start()
+	task.options.Logger.Debug("Start process %v, with: %v", args[0], args)
+	process, err = task.options.runner().Spawn(Spec{
+		Args:    args,
+		Env:     run.Env,
+		Name:    "run-" + run.Id.String(),
+		Options: task.options,
+	})
 	if err != nil {
-		task.state <- Notify{FailStart, 0, task.id}
-		log.Error("Fail start %s Task: %v, error: %v", execDescription, task.cmd, err)
+		task.state <- Notify{Action: FailStart, Id: task.id, Run: run.Id}
+		task.options.Logger.Error("Fail start %s Task: %v, error: %v", run.Description, task.cmd, err)
 		return
 	}
 
-	pid = cmd.Process.Pid
+	pid = process.Pid()
+	task.mutex.Lock()
 	task.pids = append(task.pids, pid)
-	task.state <- Notify{Start, pid, task.id}
-
-	log.Info("Task %v %s exec %v", pid, execDescription, task.cmd)
-	err = cmd.Wait()
-	if err != nil {
-		if e, ok := err.(*exec.ExitError); ok {
-			task.state <- Notify{Error, pid, task.id}
-			log.Info("Task %v fail with code: %v", pid, e.ExitCode())
+	task.mutex.Unlock()
+	task.options.registry().add(pid, run.Group, task.cmd, process)
+	task.state <- Notify{Action: Start, Pid: pid, Id: task.id, Run: run.Id}
+
+	task.options.Logger.Info("Task %v %s exec %v", pid, run.Description, task.cmd)
+	exit = process.Wait()
+	killed := task.options.registry().remove(pid)
+	if exit.Failed() {
+		if killed {
+			exit.Reason = ""
+		}
+		reason := exit.Reason
+		task.state <- Notify{Action: Error, Pid: pid, Id: task.id, Run: run.Id, ExitCode: exit.Code, Reason: reason, Killed: killed, Exit: exit}
+		if killed {
+			task.options.Logger.Warning("Task %v force killed", pid)
+		} else if reason != "" {
+			task.options.Logger.Warning("Task %v killed by limit: %v", pid, reason)
+		} else if exit.Error != "" {
+			task.options.Logger.Warning("Task wait %v fail with error: %v", pid, exit.Error)
+		} else if exit.Signal != "" {
+			if exit.CoreDumped {
+				task.options.Logger.Warning("Task %v killed by signal %v, core dumped", pid, exit.Signal)
+			} else {
+				task.options.Logger.Info("Task %v killed by signal %v", pid, exit.Signal)
+			}
 		} else {
-			log.Info("Task wait %v fail with error: %v", pid, err)
+			task.options.Logger.Info("Task %v fail with code: %v", pid, exit.Code)
 		}
 	} else {
-		log.Info("Task %v done", pid)
+		task.options.Logger.Info("Task %v done", pid)
 	}
 }
 
+func (task *Task) forget(pid int) {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+	var pids []int
+	for _, p := range task.pids {
+		if p != pid {
+			pids = append(pids, p)
+		}
+	}
+	task.pids = pids
+	var cancelled []int
+	for _, p := range task.cancelled {
+		if p != pid {
+			cancelled = append(cancelled, p)
+		}
+	}
+	task.cancelled = cancelled
+}
+
 func (task *Task) Cancel() {
-	for _, pid := range task.pids {
-		process, err := os.FindProcess(pid)
-		if err == nil {
-			err = process.Signal(os.Interrupt)
-			if err != nil {
-				log.Error("Fail interrupt pid %d, error: %v", pid, err)
-			} else {
-				log.Info("Interrupt pid %d", pid)
-			}
-		} else {
-			log.Error("Fail interrupt pid %d, error: %v", pid, err)
+	for _, pid := range task.GetPids() {
+		task.interrupt(pid)
+	}
+}
+
+func (task *Task) CancelPid(pid int) {
+	for _, p := range task.GetPids() {
+		if p == pid {
+			task.interrupt(pid)
+			return
 		}
 	}
 }
 
 func (task *Task) CancelLimited(limit int) {
-	for _, pid := range task.pids {
-		process, err := os.FindProcess(pid)
-		if err == nil {
-			err = process.Signal(os.Interrupt)
-			if err != nil {
-				log.Error("Fail interrupt pid %d, error: %v", pid, err)
-			} else {
-				log.Info("Interrupt pid %d", pid)
-			}
-		} else {
-			log.Error("Fail interrupt pid %d, error: %v", pid, err)
-		}
+	for _, pid := range task.GetPids() {
+		task.interrupt(pid)
 		limit -= 1
 		if limit <= 0 {
 			break
@@ -133,6 +197,52 @@ func (task *Task) CancelLimited(limit int) {
 	}
 }
 
+func (task *Task) interrupt(pid int) {
+	task.mutex.Lock()
+	task.cancelled = append(task.cancelled, pid)
+	task.mutex.Unlock()
+	signal := task.options.StopSignal
+	if signal == 0 {
+		signal = syscall.SIGINT
+	}
+	err := task.options.registry().signal(pid, signal)
+	if err != nil {
+		task.options.Logger.Error("Fail interrupt pid %d, error: %v", pid, err)
+		return
+	}
+	task.options.Logger.Info("Interrupt pid %d with %v", pid, signal)
+	if timeout := task.options.StopTimeout; timeout > 0 {
+		task.options.clock().AfterFunc(timeout, func() {
+			if task.options.registry().kill(pid) {
+				task.options.Logger.Warning("Task %v not stopped in %v, kill", pid, timeout)
+			}
+		})
+	}
+}
+
+func (task *Task) isCancelled(pid int) bool {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+	for _, p := range task.cancelled {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// signalGroup signals the process group led by pid, or the process only if it left the group
+func signalGroup(pid int, signal syscall.Signal) error {
+	err := syscall.Kill(-pid, signal)
+	if err == syscall.ESRCH {
+		err = syscall.Kill(pid, signal)
+	}
+	return err
+}
+
+// GetPids returns a copy of pids of running processes
 func (task *Task) GetPids() []int {
-	return task.pids
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+	return append([]int{}, task.pids...)
 }
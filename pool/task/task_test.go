@@ -0,0 +1,180 @@
+package task
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stepan-s/jobro/clock"
+)
+
+// waitStops reads notifications until the given number of processes are stopped
+func waitStops(t *testing.T, notify chan Notify, count int, timeout time.Duration) []Notify {
+	var events []Notify
+	deadline := time.After(timeout)
+	for stops := 0; stops < count; {
+		select {
+		case event := <-notify:
+			events = append(events, event)
+			if event.Action == Stop || event.Action == FailStart {
+				stops += 1
+			}
+		case <-deadline:
+			t.Fatalf("%d of %d processes stopped in %v", stops, count, timeout)
+		}
+	}
+	return events
+}
+
+func TestConcurrentExecAndCancel(t *testing.T) {
+	const count = 20
+	notify := make(chan Notify, count*4)
+	tsk := New("sleep 10", Options{}, notify)
+
+	for i := 0; i < count; i += 1 {
+		go tsk.Exec(Run{Id: uuid.New()})
+	}
+
+	// Read pids while processes are starting
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = tsk.GetPids()
+					_ = tsk.GetRunning()
+				}
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tsk.GetRunning() < count && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if running := tsk.GetRunning(); running != count {
+		t.Fatalf("running %d, want %d", running, count)
+	}
+
+	pids := tsk.GetPids()
+	go tsk.CancelPid(pids[0])
+	go tsk.Cancel()
+	waitStops(t, notify, count, 5*time.Second)
+	close(stop)
+	wg.Wait()
+
+	if running := tsk.GetRunning(); running != 0 {
+		t.Errorf("running %d after cancel, want 0", running)
+	}
+}
+
+func TestExitBySignal(t *testing.T) {
+	notify := make(chan Notify, 10)
+	tsk := New("sh -c 'kill -TERM $$'", Options{}, notify)
+	go tsk.Exec(Run{Id: uuid.New()})
+
+	var failed, stopped *Notify
+	for _, event := range waitStops(t, notify, 1, 5*time.Second) {
+		event := event
+		switch event.Action {
+		case Error:
+			failed = &event
+		case Stop:
+			stopped = &event
+		}
+	}
+	if failed == nil || stopped == nil {
+		t.Fatalf("no error or stop notification")
+	}
+	if failed.Exit == nil || failed.Exit.Signal != "TERM" || failed.Exit.Code != -1 {
+		t.Errorf("exit %+v, want TERM signal", failed.Exit)
+	}
+	if stopped.Exit != failed.Exit {
+		t.Errorf("stop exit %+v differs from error exit %+v", stopped.Exit, failed.Exit)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	notify := make(chan Notify, 10)
+	tsk := New("sh -c 'exit 3'", Options{}, notify)
+	go tsk.Exec(Run{Id: uuid.New()})
+
+	for _, event := range waitStops(t, notify, 1, 5*time.Second) {
+		if event.Action != Stop {
+			continue
+		}
+		if event.Exit == nil || event.Exit.Code != 3 || event.Exit.Signal != "" {
+			t.Errorf("exit %+v, want code 3", event.Exit)
+		}
+		if event.Exit.WallTime <= 0 {
+			t.Errorf("wall time %v, want positive", event.Exit.WallTime)
+		}
+	}
+}
+
+func TestStopTimeoutKills(t *testing.T) {
+	notify := make(chan Notify, 10)
+	runner := NewFakeRunner()
+	runner.Ignore[syscall.SIGTERM] = true
+	fake := clock.NewFake(time.Now())
+	tsk := New("worker --queue a", Options{
+		StopSignal:  syscall.SIGTERM,
+		StopTimeout: 5 * time.Second,
+		Runner:      runner,
+		Clock:       fake,
+	}, notify)
+	go tsk.Exec(Run{Id: uuid.New(), Env: []string{"A=1"}})
+
+	event := <-notify
+	if event.Action != Start {
+		t.Fatalf("action %d, want start", event.Action)
+	}
+	process := runner.Processes()[0]
+	if process.Pid() != event.Pid || process.Spec.Args[1] != "--queue" || process.Spec.Env[0] != "A=1" {
+		t.Errorf("process %d spec %+v, want the task args and run env", process.Pid(), process.Spec)
+	}
+
+	tsk.Cancel()
+	fake.Advance(4 * time.Second)
+	if process.Exited() {
+		t.Fatalf("killed before the stop timeout")
+	}
+	fake.Advance(time.Second)
+	var failed *Notify
+	for _, event := range waitStops(t, notify, 1, 5*time.Second) {
+		event := event
+		if event.Action == Error {
+			failed = &event
+		}
+	}
+	if failed == nil || !failed.Killed || failed.Exit.Signal != "KILL" {
+		t.Errorf("error %+v, want killed by KILL", failed)
+	}
+	if signals := process.Signals(); len(signals) != 2 || signals[0] != syscall.SIGTERM || signals[1] != syscall.SIGKILL {
+		t.Errorf("signals %v, want TERM and KILL", signals)
+	}
+}
+
+func TestSpawnFailure(t *testing.T) {
+	notify := make(chan Notify, 10)
+	runner := NewFakeRunner()
+	runner.SetSpawnError(errors.New("no such file"))
+	tsk := New("worker", Options{Runner: runner}, notify)
+	tsk.Exec(Run{Id: uuid.New()})
+
+	if event := <-notify; event.Action != FailStart {
+		t.Errorf("action %d, want fail start", event.Action)
+	}
+	if running := tsk.GetRunning(); running != 0 {
+		t.Errorf("running %d, want 0", running)
+	}
+}
@@ -0,0 +1,23 @@
+package task
+
+import (
+	"strings"
+	"text/template"
+)
+
+// ExpandCmd executes the command as a template with the vars, like --partition={{.Index}}
+func ExpandCmd(cmd string, vars interface{}) (string, error) {
+	if !strings.Contains(cmd, "{{") {
+		return cmd, nil
+	}
+	tpl, err := template.New("cmd").Option("missingkey=error").Parse(cmd)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	err = tpl.Execute(&out, vars)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,127 @@
+package shutdown
+
+import (
+	"github.com/stepan-s/jobro/pool/task"
+	"sync"
+	"time"
+)
+
+const StateRunning = "running"
+const StateStopping = "stopping"
+const StateStopped = "stopped"
+
+const PhasePending = "pending"
+const PhaseActive = "active"
+const PhaseDone = "done"
+
+// The phase is not finished in time, processes left are killed
+const PhaseTimeout = "timeout"
+
+// The phase is not started because of a timeout of a previous phase
+const PhaseSkipped = "skipped"
+
+type Phase struct {
+	Name     string     `json:"name"`
+	Status   string     `json:"status"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+type Status struct {
+	State  string  `json:"state"`
+	Phases []Phase `json:"phases"`
+}
+
+// Report of the finished shutdown
+type Report struct {
+	// All phases are done in time, no process is killed
+	Clean  bool                 `json:"clean"`
+	Phases []Phase              `json:"phases"`
+	Killed []task.KilledProcess `json:"killed"`
+}
+
+// Progress of the shutdown, safe for concurrent use
+type Progress struct {
+	mutex  sync.Mutex
+	state  string
+	phases []*Phase
+}
+
+func NewProgress(phases []string) *Progress {
+	progress := &Progress{state: StateRunning}
+	for _, name := range phases {
+		progress.phases = append(progress.phases, &Phase{Name: name, Status: PhasePending})
+	}
+	return progress
+}
+
+// Begin marks the phase as active and the previous active phase as done
+func (progress *Progress) Begin(name string) {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.state = StateStopping
+	progress.finish()
+	now := time.Now()
+	for _, phase := range progress.phases {
+		if phase.Name == name {
+			phase.Status = PhaseActive
+			phase.Started = &now
+			return
+		}
+	}
+}
+
+// End marks the active phase as done and the shutdown as completed
+func (progress *Progress) End() {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.finish()
+	progress.state = StateStopped
+}
+
+// Fail marks the active phase as timed out and pending phases as skipped
+func (progress *Progress) Fail() {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	now := time.Now()
+	for _, phase := range progress.phases {
+		switch phase.Status {
+		case PhaseActive:
+			phase.Status = PhaseTimeout
+			phase.Finished = &now
+		case PhasePending:
+			phase.Status = PhaseSkipped
+		}
+	}
+}
+
+// Report returns the report of the shutdown with the killed processes
+func (progress *Progress) Report(killed []task.KilledProcess) Report {
+	report := Report{Clean: len(killed) == 0, Phases: progress.GetStatus().Phases, Killed: killed}
+	for _, phase := range report.Phases {
+		if phase.Status != PhaseDone {
+			report.Clean = false
+		}
+	}
+	return report
+}
+
+func (progress *Progress) finish() {
+	now := time.Now()
+	for _, phase := range progress.phases {
+		if phase.Status == PhaseActive {
+			phase.Status = PhaseDone
+			phase.Finished = &now
+		}
+	}
+}
+
+func (progress *Progress) GetStatus() Status {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	status := Status{State: progress.state}
+	for _, phase := range progress.phases {
+		status.Phases = append(status.Phases, *phase)
+	}
+	return status
+}